@@ -3,6 +3,7 @@ package env
 import (
 	"bufio"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -30,3 +31,16 @@ func init() {
 		}
 	}
 }
+
+// GetInt returns the value of key as an int, or def when it is missing or invalid
+func GetInt(key string, def int) int {
+	value, ok := Env[key]
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var severityRank = map[Severity]int{SeverityInfo: 0, SeverityLow: 1, SeverityMedium: 2, SeverityHigh: 3}
+
+// Digest coalesces a batch of events into one. Fields shared by the whole batch are
+// kept, so a batch of a single kind still routes and renders like its events; mixed
+// batches become a KindDigest summary with the full events attached.
+func Digest(batch []Event) Event {
+	if len(batch) == 1 {
+		return batch[0]
+	}
+
+	digest := batch[0]
+	digest.Timestamp = time.Now().UTC()
+	digest.Assets = nil
+	digest.Message = ""
+	digest.Attachment = nil
+	for _, e := range batch[1:] {
+		if e.Source != digest.Source {
+			digest.Source = ""
+		}
+		if e.Platform != digest.Platform {
+			digest.Platform = ""
+		}
+		if e.Program != digest.Program {
+			digest.Program = ""
+		}
+		if e.Kind != digest.Kind {
+			digest.Kind = KindDigest
+		}
+		if e.RunID != digest.RunID {
+			digest.RunID = ""
+		}
+		if severityRank[e.Severity] > severityRank[digest.Severity] {
+			digest.Severity = e.Severity
+		}
+	}
+
+	if digest.Kind == KindDigest {
+		var summary, full []string
+		for _, e := range batch {
+			line := e.Title()
+			if e.Kind == KindText {
+				line = "Message"
+			}
+			if where := strings.Trim(e.Platform+"/"+e.Program, "/"); where != "" {
+				line += " - " + where
+			}
+			if len(e.Assets) > 0 {
+				line += fmt.Sprintf(" (%d)", len(e.Assets))
+			}
+			summary = append(summary, line)
+			full = append(full, e.Render())
+		}
+		digest.Message = fmt.Sprintf("%d notifications:\n%s", len(batch), strings.Join(summary, "\n"))
+		digest.Attachment = &Attachment{
+			Filename: fmt.Sprintf("digest-%s.txt", digest.Timestamp.Format("20060102-150405")),
+			Content:  strings.Join(full, "\n\n") + "\n",
+		}
+		return digest
+	}
+
+	// Same kind, the assets, messages and attachments are merged
+	seenAssets := make(map[string]bool)
+	seenMessages := make(map[string]bool)
+	seenPrograms := make(map[string]bool)
+	var messages, attachments, programs []string
+	for _, e := range batch {
+		if e.Program != "" && !seenPrograms[e.Program] {
+			seenPrograms[e.Program] = true
+			programs = append(programs, e.Program)
+		}
+		for _, asset := range e.Assets {
+			if !seenAssets[asset] {
+				seenAssets[asset] = true
+				digest.Assets = append(digest.Assets, asset)
+			}
+		}
+		if e.Message != "" && !seenMessages[e.Message] {
+			seenMessages[e.Message] = true
+			messages = append(messages, e.Message)
+		}
+		if e.Attachment != nil {
+			if digest.Attachment == nil {
+				digest.Attachment = &Attachment{Filename: e.Attachment.Filename, Caption: e.Attachment.Caption}
+			}
+			attachments = append(attachments, e.Attachment.Content)
+		}
+	}
+	if digest.Program == "" && len(programs) > 0 {
+		messages = append([]string{"Programs: " + strings.Join(programs, ", ")}, messages...)
+	}
+	digest.Message = strings.Join(messages, "\n")
+	if digest.Attachment != nil {
+		digest.Attachment.Content = strings.Join(attachments, "\n\n")
+	}
+	return digest
+}
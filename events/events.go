@@ -0,0 +1,214 @@
+package events
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is bumped whenever a field changes meaning or is removed
+const SchemaVersion = 1
+
+type Kind string
+
+const (
+	KindAssetsAdded       Kind = "assets_added"
+	KindAssetsRemoved     Kind = "assets_removed"
+	KindPolicyChanged     Kind = "policy_changed"
+	KindSubdomainsChanged Kind = "subdomains_changed"
+	KindSubdomainsAdded   Kind = "subdomains_added"
+	KindSubdomainsRemoved Kind = "subdomains_removed"
+	KindSubdomainsLive    Kind = "subdomains_live" // known subdomains that started resolving
+	KindHTTPChanged       Kind = "http_changed"
+	KindTakeover          Kind = "takeover"
+	KindProgramAdded      Kind = "program_added"
+	KindDigest            Kind = "digest" // several events coalesced by a notifier
+	KindText              Kind = "text"   // plain-text message from an older producer
+)
+
+type Severity string
+
+const (
+	SeverityInfo   Severity = "info"
+	SeverityLow    Severity = "low"
+	SeverityMedium Severity = "medium"
+	SeverityHigh   Severity = "high"
+)
+
+// Attachment is a file delivered along with the event
+type Attachment struct {
+	Filename string `json:"filename"`
+	Caption  string `json:"caption,omitempty"`
+	Content  string `json:"content"`
+}
+
+// Event is the message producers publish on the notification bus
+type Event struct {
+	Version    int         `json:"version"`
+	Source     string      `json:"source"`
+	Platform   string      `json:"platform,omitempty"`
+	Program    string      `json:"program,omitempty"`
+	Kind       Kind        `json:"kind"`
+	Assets     []string    `json:"assets,omitempty"`
+	Severity   Severity    `json:"severity"`
+	Timestamp  time.Time   `json:"timestamp"`
+	RunID      string      `json:"run_id,omitempty"`
+	Message    string      `json:"message,omitempty"`
+	Attachment *Attachment `json:"attachment,omitempty"`
+	// Key identifies the event across republishes, see IdempotencyKey
+	Key string `json:"key,omitempty"`
+}
+
+// New returns an event of the current schema version timestamped now
+func New(source, platform, program string, kind Kind, severity Severity, runID string) Event {
+	return Event{
+		Version:   SchemaVersion,
+		Source:    source,
+		Platform:  platform,
+		Program:   program,
+		Kind:      kind,
+		Severity:  severity,
+		Timestamp: time.Now().UTC(),
+		RunID:     runID,
+	}
+}
+
+// FromText wraps a plain-text message so it goes through the same pipeline as events
+func FromText(text string) Event {
+	return Event{
+		Version:   SchemaVersion,
+		Kind:      KindText,
+		Severity:  SeverityInfo,
+		Timestamp: time.Now().UTC(),
+		Message:   text,
+	}
+}
+
+// NewRunID returns an identifier shared by all the events of a producer run
+func NewRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(b))
+}
+
+// IdempotencyKey derives a key from the run and what the event reports: source, program,
+// kind and assets, or the message when there are none. The same change reported by a later
+// run is delivered again, a run republished after a crash reuses its run ID, see BeginRun.
+func (e Event) IdempotencyKey() string {
+	assets := append([]string(nil), e.Assets...)
+	sort.Strings(assets)
+
+	h := sha256.New()
+	for _, part := range []string{e.RunID, e.Source, e.Platform, e.Program, string(e.Kind)} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	for _, asset := range assets {
+		h.Write([]byte(asset))
+		h.Write([]byte{0})
+	}
+	if len(assets) == 0 {
+		h.Write([]byte(e.Message))
+		if e.Attachment != nil {
+			h.Write([]byte(e.Attachment.Content))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// Encode serializes the event as JSON
+func (e Event) Encode() (string, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling event: %w", err)
+	}
+	return string(data), nil
+}
+
+// Decode parses a JSON event. Payloads that are not events, like plain-text
+// messages from older producers, are returned as a KindText event.
+func Decode(payload string) Event {
+	var e Event
+	err := json.Unmarshal([]byte(payload), &e)
+	if err != nil || e.Kind == "" {
+		return FromText(payload)
+	}
+	if e.Version > SchemaVersion {
+		// Unknown fields are ignored, the common ones still render fine
+		e.Message = strings.TrimSpace(e.Message + fmt.Sprintf("\n(event schema v%d)", e.Version))
+	}
+	return e
+}
+
+// Title returns a short description of the event kind
+func (e Event) Title() string {
+	switch e.Kind {
+	case KindAssetsAdded:
+		return "New Assets In Scope"
+	case KindAssetsRemoved:
+		return "Assets Removed From Scope"
+	case KindPolicyChanged:
+		return "Policy Change Detected"
+	case KindSubdomainsChanged:
+		return "Subdomain Changes Detected"
+	case KindSubdomainsAdded:
+		return "🆕 Added Subdomains"
+	case KindSubdomainsRemoved:
+		return "🗑️ Removed Subdomains"
+	case KindSubdomainsLive:
+		return "Subdomains Now Resolving"
+	case KindHTTPChanged:
+		return "HTTP Changes Detected"
+	case KindTakeover:
+		return "⚠️ Possible Subdomain Takeover"
+	case KindProgramAdded:
+		return "New Program"
+	case KindDigest:
+		return "Notification Digest"
+	default:
+		return string(e.Kind)
+	}
+}
+
+// ProgramURL returns the public page of a program, when it can be built from its handle
+func ProgramURL(platform, program string) string {
+	switch platform {
+	case "hackerone":
+		return "https://hackerone.com/" + program
+	default:
+		return ""
+	}
+}
+
+// Render returns the event as plain text
+func (e Event) Render() string {
+	if e.Kind == KindText {
+		return e.Message
+	}
+
+	var sb strings.Builder
+	sb.WriteString(e.Title())
+	if e.Severity == SeverityHigh {
+		sb.WriteString(" [HIGH]")
+	}
+	sb.WriteString("\n")
+	if e.Platform != "" {
+		fmt.Fprintf(&sb, "Platform: %s\n", e.Platform)
+	}
+	if e.Program != "" {
+		fmt.Fprintf(&sb, "Program: %s\n", e.Program)
+	}
+	if e.Message != "" {
+		sb.WriteString(e.Message + "\n")
+	}
+	if len(e.Assets) > 0 {
+		fmt.Fprintf(&sb, "Assets (%d):\n", len(e.Assets))
+		sb.WriteString(strings.Join(e.Assets, "\n"))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,33 @@
+package events
+
+import "testing"
+
+func TestIdempotencyKey(t *testing.T) {
+	base := New("hackerone", "hackerone", "acme", KindAssetsAdded, SeverityMedium, "run-1")
+	base.Assets = []string{"a.acme.com", "b.acme.com"}
+	base.Message = "2 new assets"
+
+	tests := []struct {
+		name   string
+		change func(e *Event)
+		same   bool
+	}{
+		{"asset order", func(e *Event) { e.Assets = []string{"b.acme.com", "a.acme.com"} }, true},
+		{"message of an asset event", func(e *Event) { e.Message = "two new assets" }, true},
+		{"another run", func(e *Event) { e.RunID = "run-2" }, false},
+		{"another program", func(e *Event) { e.Program = "other" }, false},
+		{"another kind", func(e *Event) { e.Kind = KindAssetsRemoved }, false},
+		{"another asset", func(e *Event) { e.Assets = []string{"a.acme.com"} }, false},
+		{"message without assets", func(e *Event) { e.Assets = nil; e.Message = "other" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := base
+			event.Assets = append([]string(nil), base.Assets...)
+			tt.change(&event)
+			if same := event.IdempotencyKey() == base.IdempotencyKey(); same != tt.same {
+				t.Errorf("same key = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
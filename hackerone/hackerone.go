@@ -2,9 +2,12 @@ package main
 
 import (
 	"BugBountyGoApiWrapper/env"
+	"BugBountyGoApiWrapper/events"
 	"BugBountyGoApiWrapper/redismethods"
+	"BugBountyGoApiWrapper/storage"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/redis/go-redis/v9"
 	"io"
@@ -16,21 +19,37 @@ import (
 type allProgramsResponse struct {
 	Data []struct {
 		Attributes struct {
-			Handle string `json:"handle"`
+			Handle             string    `json:"handle"`
+			OffersBounties     bool      `json:"offers_bounties"`
+			StartedAcceptingAt time.Time `json:"started_accepting_at"`
 		} `json:"attributes"`
 	} `json:"data"`
 }
 
+type programSummary struct {
+	Handle         string
+	OffersBounties bool
+	Launched       time.Time // zero when unknown
+}
+
 type StructuredScope struct {
 	Data []struct {
 		Attributes struct {
-			AssetType         string `json:"asset_type"`
-			AssetIdentifier   string `json:"asset_identifier"`
-			EligibleForBounty bool   `json:"eligible_for_bounty"`
+			AssetType             string `json:"asset_type"`
+			AssetIdentifier       string `json:"asset_identifier"`
+			EligibleForBounty     bool   `json:"eligible_for_bounty"`
+			EligibleForSubmission bool   `json:"eligible_for_submission"`
 		} `json:"attributes"`
 	}
 }
 
+type programResponse struct {
+	Attributes struct {
+		Handle string `json:"handle"`
+		Policy string `json:"policy"`
+	} `json:"attributes"`
+}
+
 type HackeroneApi struct {
 	Username string
 	Token    string
@@ -39,6 +58,19 @@ type HackeroneApi struct {
 }
 
 func (api HackeroneApi) GetAllProgramsHandles() ([]string, error) {
+	programs, err := api.GetAllPrograms()
+	if err != nil {
+		return nil, err
+	}
+	var handleslice []string
+	for _, program := range programs {
+		handleslice = append(handleslice, program.Handle)
+	}
+	return handleslice, nil
+}
+
+// GetAllPrograms lists the programs with whether they pay bounties, VDPs don't
+func (api HackeroneApi) GetAllPrograms() ([]programSummary, error) {
 	// Create a request with headers
 	newurl := api.BaseUrl + "programs"
 	req, err := http.NewRequest("GET", newurl, nil)
@@ -49,7 +81,7 @@ func (api HackeroneApi) GetAllProgramsHandles() ([]string, error) {
 	req.SetBasicAuth(api.Username, api.Token)
 	query := req.URL.Query()
 	page := 0
-	var handleslice []string
+	var programs []programSummary
 	for {
 		page++
 		strpage := fmt.Sprintf("%d", page)
@@ -79,25 +111,41 @@ func (api HackeroneApi) GetAllProgramsHandles() ([]string, error) {
 			break
 		}
 		for _, program := range response.Data {
-			handleslice = append(handleslice, program.Attributes.Handle)
+			programs = append(programs, programSummary{program.Attributes.Handle, program.Attributes.OffersBounties, program.Attributes.StartedAcceptingAt})
 			//fmt.Printf(" - %s\n", program.Attributes.Handle)
 		}
 	}
 
-	//fmt.Printf("Total programs: %d\n", len(handleslice))
-	//fmt.Println("Program handles slice:")
-	//fmt.Println(handleslice)
-	return handleslice, nil
+	//fmt.Printf("Total programs: %d\n", len(programs))
+	return programs, nil
 }
 
-func (api HackeroneApi) GetProgramStructuredScope(handle string) ([]string, error) {
+// refreshBountyPrograms stores which programs pay bounties, for the bounty-only filters
+func (api HackeroneApi) refreshBountyPrograms(ctx context.Context, rdb *redis.Client) error {
+	programs, err := api.GetAllPrograms()
+	if err != nil {
+		return err
+	}
+	var bounty []string
+	for _, program := range programs {
+		if program.OffersBounties {
+			bounty = append(bounty, program.Handle)
+		}
+	}
+	fmt.Printf("Programs offering bounties: %d of %d\n", len(bounty), len(programs))
+	return redismethods.SaveBountyPrograms(ctx, rdb, "hackerone", bounty)
+}
+
+// GetProgramStructuredScope returns the URLs and wildcards eligible for bounty, and the
+// ones explicitly out of scope
+func (api HackeroneApi) GetProgramStructuredScope(handle string) ([]string, []string, error) {
 	// Create a request with headers
 	var response StructuredScope
-	var urlsAndWildcards []string
+	var urlsAndWildcards, outOfScope []string
 	newurl := api.BaseUrl + "programs/" + handle + "/structured_scopes"
 	req, err := http.NewRequest("GET", newurl, nil)
 	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
+		return nil, nil, fmt.Errorf("error creating request: %w", err)
 	}
 
 	req.SetBasicAuth(api.Username, api.Token)
@@ -106,41 +154,156 @@ func (api HackeroneApi) GetProgramStructuredScope(handle string) ([]string, erro
 
 	resp, err := api.Client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error sending request: %w", err)
+		return nil, nil, fmt.Errorf("error sending request: %w", err)
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %w", err)
+		return nil, nil, fmt.Errorf("error reading response body: %w", err)
 	}
 	// fmt.Println("Body content:")
 	// fmt.Println(string(body))
 	err = json.Unmarshal(body, &response)
 	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling the response: %w", err)
+		return nil, nil, fmt.Errorf("error unmarshalling the response: %w", err)
 	}
 	for _, scope := range response.Data {
 		if (scope.Attributes.AssetType == "URL" || scope.Attributes.AssetType == "WILDCARD") &&
 			scope.Attributes.EligibleForBounty {
 			urlsAndWildcards = append(urlsAndWildcards, scope.Attributes.AssetIdentifier)
 		}
+		if (scope.Attributes.AssetType == "URL" || scope.Attributes.AssetType == "WILDCARD") &&
+			!scope.Attributes.EligibleForSubmission {
+			outOfScope = append(outOfScope, scope.Attributes.AssetIdentifier)
+		}
 	}
 
 	//fmt.Println("URLs and Wildcards eligible for bounty:")
 	//for _, item := range urlsAndWildcards {
 	//	fmt.Println(item)
 	//}
-	return urlsAndWildcards, nil
+	return urlsAndWildcards, outOfScope, nil
 }
 
-func (api HackeroneApi) GetAllUrlsProducer() ([]string, error) {
+func (api HackeroneApi) GetProgramPolicy(handle string) (string, error) {
+	var response programResponse
+	newurl := api.BaseUrl + "programs/" + handle
+	req, err := http.NewRequest("GET", newurl, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.SetBasicAuth(api.Username, api.Token)
+
+	resp, err := api.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response body: %w", err)
+	}
+	// Rate limits and server errors have a JSON body too, it must not be read as a policy
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d for %s", resp.StatusCode, handle)
+	}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return "", fmt.Errorf("error unmarshalling the response: %w", err)
+	}
+
+	return response.Attributes.Policy, nil
+}
+
+// CheckPolicyChanges fetches every program policy, publishes diffs and stores new versions.
+// It returns how many policies were checked and how many changed.
+func (api HackeroneApi) CheckPolicyChanges(ctx context.Context, rdb *redis.Client, runID string) (checked int, changed int, err error) {
 	allhandles, err := api.GetAllProgramsHandles()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, handle := range allhandles {
+		policy, err := api.GetProgramPolicy(handle)
+		if err != nil {
+			fmt.Printf("Error fetching policy for %s: %v\n", handle, err)
+			continue
+		}
+
+		updated, err := redismethods.CheckPolicy(ctx, rdb, "hackerone", handle, runID, policy)
+		if err != nil {
+			fmt.Printf("Error checking policy for %s: %v\n", handle, err)
+		} else if updated {
+			changed++
+		}
+
+		// Rate limiting: sleep between requests
+		time.Sleep(1 * time.Second)
+	}
+
+	fmt.Printf("Policies checked: %d, changed: %d\n", len(allhandles), changed)
+	return len(allhandles), changed, nil
+}
+
+// watchPolicies checks the program policies and refreshes the bounty programs every interval
+func (api HackeroneApi) watchPolicies(ctx context.Context, rdb *redis.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, _, err := api.CheckPolicyChanges(ctx, rdb, events.NewRunID())
+		if err != nil {
+			fmt.Println("Error checking HackerOne policies:", err)
+		}
+		err = api.refreshBountyPrograms(ctx, rdb)
+		if err != nil {
+			fmt.Println("Error refreshing bounty programs:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type programScope struct {
+	handle     string
+	urls       []string
+	outOfScope []string
+}
+
+func (api HackeroneApi) GetAllUrlsProducer() ([]string, error) {
+	scopes, _, err := api.GetAllScopesProducer()
 	if err != nil {
 		return nil, err
 	}
 
+	var allUrls []string
+	for _, urls := range scopes {
+		allUrls = append(allUrls, urls...)
+	}
+
+	fmt.Printf("Total URLs collected: %d\n", len(allUrls))
+	return allUrls, nil
+}
+
+// GetAllScopesProducer fetches the structured scope of every program, keyed by program handle,
+// along with the out of scope entries of every program
+func (api HackeroneApi) GetAllScopesProducer() (map[string][]string, map[string][]string, error) {
+	allhandles, err := api.GetAllProgramsHandles()
+	if err != nil {
+		return nil, nil, err
+	}
+	return api.GetScopes(allhandles)
+}
+
+// GetScopes fetches the structured scope and out of scope entries of the programs
+func (api HackeroneApi) GetScopes(allhandles []string) (map[string][]string, map[string][]string, error) {
 	jobs := make(chan string, len(allhandles))
-	results := make(chan []string, len(allhandles))
+	results := make(chan programScope, len(allhandles))
 	errorsChan := make(chan error, len(allhandles))
 
 	numWorkers := 10
@@ -158,12 +321,12 @@ func (api HackeroneApi) GetAllUrlsProducer() ([]string, error) {
 			for handle := range jobs {
 				//fmt.Printf("Worker %d processing handle: %s\n", workerID, handle)
 
-				urls, err := api.GetProgramStructuredScope(handle)
+				urls, outOfScope, err := api.GetProgramStructuredScope(handle)
 				if err != nil {
 					errorsChan <- fmt.Errorf("error fetching scope for %s: %w", handle, err)
 					continue
 				}
-				results <- urls
+				results <- programScope{handle, urls, outOfScope}
 
 				// Rate limiting: sleep between requests
 				time.Sleep(1 * time.Second) // Wait 1 second between API calls
@@ -182,19 +345,131 @@ func (api HackeroneApi) GetAllUrlsProducer() ([]string, error) {
 	close(errorsChan)
 
 	if len(errorsChan) > 0 {
-		return nil, fmt.Errorf("encountered errors while fetching scopes")
+		return nil, nil, fmt.Errorf("encountered errors while fetching scopes")
 	}
 
-	var allUrls []string
-	for urlSlice := range results {
-		allUrls = append(allUrls, urlSlice...)
+	scopes := make(map[string][]string, len(allhandles))
+	outOfScope := make(map[string][]string)
+	for scope := range results {
+		scopes[scope.handle] = scope.urls
+		if len(scope.outOfScope) > 0 {
+			outOfScope[scope.handle] = scope.outOfScope
+		}
 	}
 
-	fmt.Printf("Total URLs collected: %d\n", len(allUrls))
-	return allUrls, nil
+	return scopes, outOfScope, nil
+}
+
+// newProgramDays is how recently an untracked program must have launched for its whole
+// scope to be logged as added, older ones only became visible, e.g. a private invitation
+const newProgramDays = 30
+
+// recordHistory updates the per program scope history, including programs that are gone,
+// and publishes the programs seen for the first time
+func recordHistory(ctx context.Context, rdb *redis.Client, scopes map[string][]string, launched map[string]time.Time, runID string) map[string]bool {
+	now := time.Now()
+	tracked, err := redismethods.GetTrackedPrograms(ctx, rdb, "hackerone")
+	if err != nil {
+		fmt.Println("Error getting tracked programs from Redis:", err)
+	}
+	known := make(map[string]bool, len(tracked))
+	for _, handle := range tracked {
+		known[handle] = true
+		if _, ok := scopes[handle]; !ok {
+			scopes[handle] = nil
+		}
+	}
+
+	// Nothing is tracked on the first run, every program would be new
+	firstRun := err != nil || len(tracked) == 0
+	added := make(map[string]bool)
+	if !firstRun {
+		for handle, urls := range scopes {
+			if known[handle] {
+				continue
+			}
+			added[handle] = true
+			event := events.New("hackerone", "hackerone", handle, events.KindProgramAdded, events.SeverityHigh, runID)
+			event.Assets = redismethods.GetUniqueURLs(urls)
+			err = redismethods.PublishEvent(ctx, rdb, event)
+			if err != nil {
+				fmt.Println("Error publishing to Redis:", err)
+			}
+		}
+	}
+
+	changed := 0
+	for handle, urls := range scopes {
+		// Untracked programs are seeded, unless they just launched and their scope is new
+		launch := launched[handle]
+		justLaunched := !firstRun && (launch.IsZero() || now.Sub(launch) < newProgramDays*24*time.Hour)
+		seed := !known[handle] && !justLaunched
+		changes, err := redismethods.RecordScopeHistory(ctx, rdb, "hackerone", handle, urls, now, seed)
+		if err != nil {
+			fmt.Printf("Error recording scope history for %s: %v\n", handle, err)
+			continue
+		}
+		if len(changes) > 0 {
+			changed++
+		}
+	}
+	fmt.Printf("Scope history updated, programs with changes: %d\n", changed)
+	return added
+}
+
+// publishChanges publishes one event per program for the added or removed assets, except for
+// the skipped programs whose assets were already announced. It returns the last error so the
+// snapshot is not committed when an event was lost.
+func publishChanges(ctx context.Context, rdb *redis.Client, kind events.Kind, severity events.Severity, assets []string, skip map[string]bool, runID string) error {
+	groups, err := redismethods.GroupByProgram(ctx, rdb, "hackerone", assets)
+	if err != nil {
+		fmt.Println("Error grouping assets by program:", err)
+		groups = map[string][]string{"": assets}
+	}
+
+	var failed error
+	for program, programAssets := range groups {
+		if skip[program] {
+			continue
+		}
+		event := events.New("hackerone", "hackerone", program, kind, severity, runID)
+		event.Assets = programAssets
+		err = redismethods.PublishEvent(ctx, rdb, event)
+		if err != nil {
+			fmt.Println("Error publishing to Redis:", err)
+			failed = err
+		}
+	}
+	return failed
+}
+
+// printChanges prints the change log of a program for the last days
+func printChanges(ctx context.Context, rdb *redis.Client, handle string, days int) error {
+	since := time.Now().AddDate(0, 0, -days)
+	changes, err := redismethods.GetProgramChanges(ctx, rdb, "hackerone", handle, since)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Changes in %s since %s: %d\n", handle, since.Format("2006-01-02"), len(changes))
+	records, err := redismethods.GetAssetRecords(ctx, rdb, "hackerone", handle)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		record := records[change.Asset]
+		fmt.Printf("%s %-8s %s (first seen %s, last seen %s)\n",
+			change.Time.Format("2006-01-02 15:04"), change.Kind, change.Asset,
+			record.FirstSeen.Format("2006-01-02"), record.LastSeen.Format("2006-01-02"))
+	}
+	return nil
 }
 
 func main() {
+	changesFor := flag.String("changes", "", "print the scope changes of a program and exit")
+	days := flag.Int("days", 30, "number of days of changes to print with -changes")
+	flag.Parse()
+
 	transport := &http.Transport{
 		MaxIdleConns:        100,
 		MaxIdleConnsPerHost: 10,
@@ -226,6 +501,22 @@ func main() {
 	}
 	fmt.Println("Connected to Redis!")
 
+	// Snapshots can live in Redis, SQLite or JSON files
+	store, err := storage.Open(env.Env["SNAPSHOT_BACKEND"], env.Env["SNAPSHOT_PATH"], rdb)
+	if err != nil {
+		fmt.Println("Snapshot store error:", err)
+		return
+	}
+	defer store.Close()
+
+	if *changesFor != "" {
+		err = printChanges(ctx, rdb, *changesFor, *days)
+		if err != nil {
+			fmt.Println("Error getting program changes:", err)
+		}
+		return
+	}
+
 	// Infinite loop that runs every 5 minutes
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
@@ -233,54 +524,122 @@ func main() {
 	// Counter for tracking runs
 	runCount := 0
 
+	// Policies change rarely and take long to fetch one by one, they are checked on their own
+	// ticker so the scope loop is never held up
+	policyMinutes := env.GetInt("POLICY_CHECK_MINUTES", 60)
+	if policyMinutes <= 0 {
+		policyMinutes = 60
+	}
+	go hackeronecli.watchPolicies(ctx, rdb, time.Duration(policyMinutes)*time.Minute)
+
+	// Assets missing for a short time are not reported as removed
+	flapConfig := redismethods.FlapConfig{
+		MissingRuns: env.GetInt("FLAP_MISSING_RUNS", 3),
+		MissingFor:  time.Duration(env.GetInt("FLAP_MISSING_MINUTES", 0)) * time.Minute,
+	}
+
+	// Every run ends here, failed ones included, so a persistent error never turns into a
+	// tight loop refetching every scope
+	waitForNextRun := func() {
+		fmt.Printf("Waiting for next run at %s...\n", time.Now().Add(5*time.Minute).Format("15:04:05"))
+		redismethods.WaitForNextRun(ctx, rdb, "hackerone", 5*time.Minute)
+	}
+
 	for {
 		runCount++
-		fmt.Printf("\n=== Run #%d at %s ===\n", runCount, time.Now().Format("15:04:05"))
+		// A run that did not publish everything is run again under the same ID
+		runID := redismethods.BeginRun(ctx, rdb, "hackerone")
+		fmt.Printf("\n=== Run #%d at %s (%s) ===\n", runCount, time.Now().Format("15:04:05"), runID)
 
 		// Get current URLs
-		currentURLs, err := hackeronecli.GetAllUrlsProducer()
+		programs, err := hackeronecli.GetAllPrograms()
+		if err != nil {
+			fmt.Println("Error getting programs from HackerOne:", err)
+			waitForNextRun()
+			continue
+		}
+		handles := make([]string, 0, len(programs))
+		launched := make(map[string]time.Time, len(programs))
+		for _, program := range programs {
+			handles = append(handles, program.Handle)
+			launched[program.Handle] = program.Launched
+		}
+		scopes, outOfScope, err := hackeronecli.GetScopes(handles)
 		if err != nil {
 			fmt.Println("Error getting URLs from HackerOne:", err)
+			waitForNextRun()
 			continue
 		}
 
+		var currentURLs []string
+		for _, urls := range scopes {
+			currentURLs = append(currentURLs, urls...)
+		}
+
+		// New programs are announced with their assets, they are not reported again as added
+		newPrograms := recordHistory(ctx, rdb, scopes, launched, runID)
+		err = redismethods.SaveAssetPrograms(ctx, rdb, "hackerone", scopes)
+		if err != nil {
+			fmt.Println("Error saving asset programs:", err)
+		}
+		// The subfinder drops subdomains matching these
+		err = redismethods.SaveOutOfScope(ctx, rdb, "hackerone", outOfScope)
+		if err != nil {
+			fmt.Println("Error saving out of scope entries:", err)
+		}
+
 		fmt.Printf("Total URLs collected: %d\n", len(currentURLs))
 
 		// Convert to unique set for comparison
 		currentUnique := redismethods.GetUniqueURLs(currentURLs)
 		fmt.Printf("Unique URLs: %d\n", len(currentUnique))
 
-		// Try to get previous URLs from Redis
-		previousUnique, err := redismethods.GetPreviousURLs(ctx, rdb)
-		if err != nil {
-			fmt.Println("No previous URLs found, initializing Redis with current URLs...")
-
-			// Initialize Redis with current unique URLs
-			err = redismethods.SaveURLsToRedis("hackerone:previous_urls", ctx, rdb, currentUnique)
+		// Compare with the snapshot, it is only replaced once the changes are published so
+		// that a failed run reports them again
+		var added, removed []string
+		var missing *redismethods.MissingState
+		err = store.Update(ctx, "hackerone:previous_urls", currentUnique, func(a []string, r []string) error {
+			// Hold back removals until they are confirmed
+			var err error
+			added, removed, missing, err = redismethods.ApplyHysteresis(ctx, rdb, "hackerone:missing_urls", flapConfig, a, r, currentUnique, time.Now())
 			if err != nil {
-				fmt.Println("Error initializing Redis:", err)
-			} else {
-				fmt.Println("Successfully initialized Redis with current URLs")
+				return fmt.Errorf("error applying flap suppression: %v", err)
 			}
-
-			// Wait for next tick and continue
+			if len(added) > 0 {
+				err = publishChanges(ctx, rdb, events.KindAssetsAdded, events.SeverityMedium, added, newPrograms, runID)
+			}
+			if len(removed) > 0 {
+				if removedErr := publishChanges(ctx, rdb, events.KindAssetsRemoved, events.SeverityInfo, removed, nil, runID); removedErr != nil {
+					err = removedErr
+				}
+			}
+			return err
+		})
+		if err == storage.ErrNoSnapshot {
+			fmt.Println("No previous URLs found, snapshot store initialized with current URLs")
+			redismethods.FinishRun(ctx, rdb, "hackerone")
+			waitForNextRun()
+			continue
+		} else if err == storage.ErrConflict {
+			fmt.Println("Snapshot saved by another monitor meanwhile, run skipped")
+			waitForNextRun()
+			continue
+		} else if err != nil {
+			fmt.Println("Error updating snapshot:", err)
+			fmt.Println("Snapshot kept, the changes will be published again next run")
+			waitForNextRun()
 			continue
 		}
-
-		fmt.Printf("Previous unique URLs: %d\n", len(previousUnique))
-		fmt.Printf("Current unique URLs: %d\n", len(currentUnique))
-
-		// Compare unique URLs
-		added, removed := redismethods.CompareUniqueURLs(previousUnique, currentUnique)
+		redismethods.FinishRun(ctx, rdb, "hackerone")
+		err = missing.Commit(ctx, rdb)
+		if err != nil {
+			fmt.Println("Error saving missing URLs:", err)
+		}
 
 		fmt.Printf("Changes detected - New URLs: %d, Removed URLs: %d\n", len(added), len(removed))
 
 		// Print the differences if any
 		if len(added) > 0 {
-			err := rdb.Publish(ctx, "telegram_notifications", fmt.Sprintf("Added: %v", added)).Err()
-			if err != nil {
-				fmt.Println("Error publishing to Redis:", err)
-			}
 			fmt.Println("\n=== NEW URLs ADDED ===")
 			for i, url := range added {
 				if i < 10 { // Only show first 10 to avoid spam
@@ -293,10 +652,6 @@ func main() {
 		}
 
 		if len(removed) > 0 {
-			err := rdb.Publish(ctx, "telegram_notifications", fmt.Sprintf("Removed: %v", removed)).Err()
-			if err != nil {
-				fmt.Println("Error publishing to Redis:", err)
-			}
 			fmt.Println("\n=== URLs REMOVED ===")
 			for i, url := range removed {
 				if i < 10 { // Only show first 10 to avoid spam
@@ -315,15 +670,16 @@ func main() {
 			fmt.Printf("Summary: +%d / -%d URLs\n", len(added), len(removed))
 		}
 
-		// Save current unique URLs as the new previous state
-		err = redismethods.SaveURLsToRedis("hackerone:previous_urls", ctx, rdb, currentUnique)
+		err = redismethods.RecordRunStatus(ctx, rdb, "hackerone", map[string]int{
+			"programs": len(scopes),
+			"urls":     len(currentUnique),
+			"added":    len(added),
+			"removed":  len(removed),
+		})
 		if err != nil {
-			fmt.Println("Error saving URLs to Redis:", err)
-		} else {
-			fmt.Println("Current URLs saved to Redis for next comparison")
+			fmt.Println("Error saving run status:", err)
 		}
 
-		fmt.Printf("Waiting for next run at %s...\n", time.Now().Add(5*time.Minute).Format("15:04:05"))
-		time.Sleep(5 * time.Minute)
+		waitForNextRun()
 	}
 }
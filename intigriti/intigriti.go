@@ -2,17 +2,40 @@ package main
 
 import (
 	"BugBountyGoApiWrapper/env"
+	"BugBountyGoApiWrapper/events"
+	"BugBountyGoApiWrapper/redismethods"
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/redis/go-redis/v9"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
+type program struct {
+	Id     string `json:"id"`
+	Handle string `json:"handle"`
+}
+
 type allProgramsResponse struct {
-	Records []struct {
-		Handle string `json:"handle"`
-	} `json:"records"`
+	Records []program `json:"records"`
+}
+
+type programDetailsResponse struct {
+	RulesOfEngagement struct {
+		Content struct {
+			Description         string `json:"description"`
+			TestingRequirements struct {
+				IntigritiMe      bool   `json:"intigritiMe"`
+				AutomatedTooling int    `json:"automatedTooling"`
+				UserAgent        string `json:"userAgent"`
+				RequestHeader    string `json:"requestHeader"`
+			} `json:"testingRequirements"`
+			SafeHarbour bool `json:"safeHarbour"`
+		} `json:"content"`
+	} `json:"rulesOfEngagement"`
 }
 
 type StructuredScope struct {
@@ -32,6 +55,22 @@ type IntigritiApi struct {
 }
 
 func (api IntigritiApi) GetAllProgramsHandles() ([]string, error) {
+	programs, err := api.GetAllPrograms()
+	if err != nil {
+		return nil, err
+	}
+
+	var handleslice []string
+	for _, program := range programs {
+		handleslice = append(handleslice, program.Handle)
+		//fmt.Printf(" - %s\n", program.Handle)
+	}
+
+	//fmt.Println(handleslice)
+	return handleslice, nil
+}
+
+func (api IntigritiApi) GetAllPrograms() ([]program, error) {
 	// Create a request with headers
 	newurl := api.BaseUrl + "/programs"
 	req, err := http.NewRequest("GET", newurl, nil)
@@ -41,7 +80,6 @@ func (api IntigritiApi) GetAllProgramsHandles() ([]string, error) {
 	var response allProgramsResponse
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", api.Key))
 	query := req.URL.Query()
-	var handleslice []string
 
 	query.Set("typeId", "1")
 	query.Set("limit", "500")
@@ -59,19 +97,88 @@ func (api IntigritiApi) GetAllProgramsHandles() ([]string, error) {
 		return nil, fmt.Errorf("error reading response body: %w", err)
 	}
 	//fmt.Println("Body content:")
-	fmt.Println(string(body))
+	//fmt.Println(string(body))
 	err = json.Unmarshal(body, &response)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshalling the response: %w", err)
 	}
 
-	for _, program := range response.Records {
-		handleslice = append(handleslice, program.Handle)
-		//fmt.Printf(" - %s\n", program.Attributes.Handle)
+	return response.Records, nil
+}
+
+func (api IntigritiApi) GetProgramPolicy(id string) (string, error) {
+	var response programDetailsResponse
+	newurl := api.BaseUrl + "/programs/" + id
+	req, err := http.NewRequest("GET", newurl, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
 	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", api.Key))
 
-	//fmt.Println(handleslice)
-	return handleslice, nil
+	resp, err := api.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response body: %w", err)
+	}
+	// Rate limits and server errors have a JSON body too, it must not be read as a policy
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d for %s", resp.StatusCode, id)
+	}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return "", fmt.Errorf("error unmarshalling the response: %w", err)
+	}
+
+	// Flatten the rules of engagement into a single text so it can be diffed
+	content := response.RulesOfEngagement.Content
+	if strings.TrimSpace(content.Description) == "" {
+		// Nothing to diff, the caller skips empty policies
+		return "", nil
+	}
+	var sb strings.Builder
+	sb.WriteString(content.Description)
+	sb.WriteString("\n\nTesting requirements:\n")
+	fmt.Fprintf(&sb, "Intigriti.me required: %t\n", content.TestingRequirements.IntigritiMe)
+	fmt.Fprintf(&sb, "Automated tooling: %d\n", content.TestingRequirements.AutomatedTooling)
+	fmt.Fprintf(&sb, "User agent: %s\n", content.TestingRequirements.UserAgent)
+	fmt.Fprintf(&sb, "Request header: %s\n", content.TestingRequirements.RequestHeader)
+	fmt.Fprintf(&sb, "Safe harbour: %t\n", content.SafeHarbour)
+
+	return sb.String(), nil
+}
+
+// CheckPolicyChanges fetches every program policy, publishes diffs and stores new versions.
+// It returns how many policies were checked and how many changed.
+func (api IntigritiApi) CheckPolicyChanges(ctx context.Context, rdb *redis.Client, runID string) (checked int, changed int, err error) {
+	programs, err := api.GetAllPrograms()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, program := range programs {
+		policy, err := api.GetProgramPolicy(program.Id)
+		if err != nil {
+			fmt.Printf("Error fetching policy for %s: %v\n", program.Handle, err)
+			continue
+		}
+
+		updated, err := redismethods.CheckPolicy(ctx, rdb, "intigriti", program.Handle, runID, policy)
+		if err != nil {
+			fmt.Printf("Error checking policy for %s: %v\n", program.Handle, err)
+		} else if updated {
+			changed++
+		}
+
+		// Rate limiting: sleep between requests
+		time.Sleep(1 * time.Second)
+	}
+
+	fmt.Printf("Policies checked: %d, changed: %d\n", len(programs), changed)
+	return len(programs), changed, nil
 }
 
 func main() {
@@ -102,4 +209,36 @@ func main() {
 	fmt.Println("Total programs:", len(test))
 	fmt.Println("Program handles slice:")
 	fmt.Println(test)
+
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+
+	// Test Redis connection
+	_, err = rdb.Ping(ctx).Result()
+	if err != nil {
+		fmt.Println("Redis error:", err)
+		return
+	}
+	fmt.Println("Connected to Redis!")
+
+	// Check the rules of engagement every hour
+	for {
+		runID := events.NewRunID()
+		fmt.Printf("\n=== Policy check at %s (%s) ===\n", time.Now().Format("15:04:05"), runID)
+		checked, changed, err := intigriticli.CheckPolicyChanges(ctx, rdb, runID)
+		if err != nil {
+			fmt.Println("Error checking Intigriti policies:", err)
+		} else {
+			err = redismethods.RecordRunStatus(ctx, rdb, "intigriti", map[string]int{
+				"programs":         checked,
+				"policies_changed": changed,
+			})
+			if err != nil {
+				fmt.Println("Error saving run status:", err)
+			}
+		}
+
+		fmt.Printf("Waiting for next run at %s...\n", time.Now().Add(60*time.Minute).Format("15:04:05"))
+		redismethods.WaitForNextRun(ctx, rdb, "intigriti", 60*time.Minute)
+	}
 }
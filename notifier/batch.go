@@ -0,0 +1,207 @@
+package notifier
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"time"
+)
+
+// Batcher holds back events for Window and sends each key's batch as one digest.
+// Batches live in Redis so they survive restarts, events of a Bypass kind or of
+// high severity are never held back.
+type Batcher struct {
+	Client *redis.Client
+	Name   string
+	Window time.Duration
+	Bypass []events.Kind
+	// Send delivers the digest of the batch queued under key
+	Send func(ctx context.Context, key string, event events.Event) error
+	// MaxQueued caps the events kept in a batch while its sends keep failing, the oldest
+	// are dropped first, 0 keeps them all
+	MaxQueued int
+}
+
+func NewBatcher(rdb *redis.Client, name string, window time.Duration, bypass []events.Kind) *Batcher {
+	return &Batcher{Client: rdb, Name: name, Window: window, Bypass: bypass}
+}
+
+func (b *Batcher) dueKey() string {
+	return fmt.Sprintf("batch:%s:due", b.Name)
+}
+
+func (b *Batcher) listKey(key string) string {
+	return fmt.Sprintf("batch:%s:events:%s", b.Name, key)
+}
+
+// bypasses reports whether the event must be sent right away
+func (b *Batcher) bypasses(event events.Event) bool {
+	if b.Window <= 0 || event.Severity == events.SeverityHigh {
+		return true
+	}
+	for _, kind := range b.Bypass {
+		if kind == event.Kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Add queues the event in the batch of key. It returns false when the event bypasses
+// batching and must be sent by the caller.
+func (b *Batcher) Add(ctx context.Context, key string, event events.Event) (bool, error) {
+	if b.bypasses(event) {
+		return false, nil
+	}
+	payload, err := event.Encode()
+	if err != nil {
+		return false, err
+	}
+
+	// The first event of a batch sets when it is due
+	pipe := b.Client.TxPipeline()
+	pipe.RPush(ctx, b.listKey(key), payload)
+	pipe.ZAddNX(ctx, b.dueKey(), redis.Z{Score: float64(time.Now().Add(b.Window).Unix()), Member: key})
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error queueing event in batch: %w", err)
+	}
+	return true, nil
+}
+
+// Run sends the batches that are due until ctx is done
+func (b *Batcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		due, err := b.Client.ZRangeByScore(ctx, b.dueKey(), &redis.ZRangeBy{
+			Min: "-inf",
+			Max: fmt.Sprint(time.Now().Unix()),
+		}).Result()
+		if err != nil {
+			log.Printf("[%s] Error reading due batches: %v", b.Name, err)
+			continue
+		}
+		for _, key := range due {
+			err = b.flush(ctx, key)
+			if err != nil {
+				log.Printf("[%s] Error sending batch %q, retrying in %v: %v", b.Name, key, b.Window, err)
+			}
+		}
+	}
+}
+
+// flush sends the batch of key as a digest
+func (b *Batcher) flush(ctx context.Context, key string) error {
+	// Removing the key claims the batch, another process flushing at the same time gets 0.
+	// It is put back as a lease, if we die the batch is retried after a window.
+	claimed, err := b.Client.ZRem(ctx, b.dueKey(), key).Result()
+	if err != nil || claimed == 0 {
+		return err
+	}
+	err = b.Client.ZAddNX(ctx, b.dueKey(), redis.Z{Score: float64(time.Now().Add(b.Window).Unix()), Member: key}).Err()
+	if err != nil {
+		return fmt.Errorf("error leasing batch: %w", err)
+	}
+
+	payloads, err := b.Client.LRange(ctx, b.listKey(key), 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("error reading batch: %w", err)
+	}
+	if len(payloads) > 0 {
+		var batch []events.Event
+		for _, payload := range payloads {
+			batch = append(batch, events.Decode(payload))
+		}
+
+		err = b.Send(ctx, key, events.Digest(batch))
+		if err != nil {
+			b.capBatch(ctx, key)
+			return err
+		}
+		log.Printf("[%s] Sent batch %q of %d events", b.Name, key, len(batch))
+
+		// Events added while sending stay queued under the lease
+		err = b.Client.LTrim(ctx, b.listKey(key), int64(len(payloads)), -1).Err()
+		if err != nil {
+			return fmt.Errorf("error trimming batch: %w", err)
+		}
+	}
+
+	// Drop the lease unless an event arrived meanwhile, watching the list so one
+	// pushed between the check and the removal aborts it
+	err = b.Client.Watch(ctx, func(tx *redis.Tx) error {
+		n, err := tx.LLen(ctx, b.listKey(key)).Result()
+		if err != nil || n > 0 {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZRem(ctx, b.dueKey(), key)
+			return nil
+		})
+		return err
+	}, b.listKey(key))
+	if err == redis.TxFailedErr {
+		return nil
+	}
+	return err
+}
+
+// capBatch drops the oldest events of the batch of key beyond MaxQueued, so a backend that
+// keeps failing does not grow it forever
+func (b *Batcher) capBatch(ctx context.Context, key string) {
+	if b.MaxQueued <= 0 {
+		return
+	}
+	queued, err := b.Client.LLen(ctx, b.listKey(key)).Result()
+	if err != nil || queued <= int64(b.MaxQueued) {
+		return
+	}
+	err = b.Client.LTrim(ctx, b.listKey(key), int64(-b.MaxQueued), -1).Err()
+	if err != nil {
+		log.Printf("[%s] Error trimming batch %q: %v", b.Name, key, err)
+		return
+	}
+	log.Printf("[%s] Dropped the %d oldest events of batch %q", b.Name, queued-int64(b.MaxQueued), key)
+}
+
+// batched queues the events of a notifier in one batch per program
+type batched struct {
+	Notifier
+	batcher *Batcher
+}
+
+// WithBatching coalesces the events sent to n with the batcher, the caller runs b.Run
+func WithBatching(n Notifier, b *Batcher) Notifier {
+	b.Send = func(ctx context.Context, key string, event events.Event) error {
+		return n.Notify(ctx, event)
+	}
+	return &batched{Notifier: n, batcher: b}
+}
+
+func (b *batched) Notify(ctx context.Context, event events.Event) error {
+	queued, err := b.batcher.Add(ctx, batchKey(event), event)
+	if err != nil {
+		log.Printf("[%s] Error batching event, sending it now: %v", b.Name(), err)
+	}
+	if queued {
+		return nil
+	}
+	return b.Notifier.Notify(ctx, event)
+}
+
+// batchKey groups the events of a program, those without one are batched together
+func batchKey(event events.Event) string {
+	if event.Program == "" {
+		return "all"
+	}
+	return event.Platform + ":" + event.Program
+}
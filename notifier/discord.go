@@ -0,0 +1,158 @@
+package notifier
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// discordMaxDescription is the maximum length of an embed description
+const discordMaxDescription = 4096
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	URL         string         `json:"url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Timestamp   string         `json:"timestamp"`
+	Footer      *struct {
+		Text string `json:"text"`
+	} `json:"footer,omitempty"`
+}
+
+type discordPayload struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []discordEmbed `json:"embeds,omitempty"`
+}
+
+// DiscordNotifier posts events as embeds to a Discord webhook
+type DiscordNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func NewDiscord(webhookURL string) *DiscordNotifier {
+	return &DiscordNotifier{WebhookURL: webhookURL, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (d *DiscordNotifier) Name() string {
+	return "discord"
+}
+
+func (d *DiscordNotifier) Notify(ctx context.Context, event events.Event) error {
+	payload, attachment := discordMessage(event)
+	return withRetry(3, func() error {
+		if attachment == nil {
+			data, err := json.Marshal(payload)
+			if err != nil {
+				return fmt.Errorf("error marshaling JSON: %w", err)
+			}
+			return postJSON(d.Client, d.WebhookURL, data)
+		}
+		return d.upload(payload, attachment)
+	})
+}
+
+// upload sends the message with the attachment as a file, multipart/form-data
+func (d *DiscordNotifier) upload(payload discordPayload, attachment *events.Attachment) error {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %w", err)
+	}
+	err = writer.WriteField("payload_json", string(data))
+	if err != nil {
+		return fmt.Errorf("error writing form field: %w", err)
+	}
+	part, err := writer.CreateFormFile("files[0]", attachment.Filename)
+	if err != nil {
+		return fmt.Errorf("error creating form file: %w", err)
+	}
+	_, err = part.Write([]byte(attachment.Content))
+	if err != nil {
+		return fmt.Errorf("error writing attachment content: %w", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		return fmt.Errorf("error closing multipart writer: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", d.WebhookURL, &buf)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return post(d.Client, req)
+}
+
+func severityColor(severity events.Severity) int {
+	switch severity {
+	case events.SeverityHigh:
+		return 0xE74C3C
+	case events.SeverityMedium:
+		return 0xF39C12
+	case events.SeverityLow:
+		return 0x3498DB
+	default:
+		return 0x95A5A6
+	}
+}
+
+// discordMessage builds the embed of an event. Asset lists that don't fit in the
+// description are sent as a file, like attachments.
+func discordMessage(event events.Event) (discordPayload, *events.Attachment) {
+	attachment := event.Attachment
+	if event.Kind == events.KindText {
+		return discordPayload{Content: truncate(event.Message, 1900)}, attachment
+	}
+
+	embed := discordEmbed{
+		Title:     event.Title(),
+		URL:       events.ProgramURL(event.Platform, event.Program),
+		Color:     severityColor(event.Severity),
+		Timestamp: event.Timestamp.Format(time.RFC3339),
+	}
+	if event.Platform != "" {
+		embed.Fields = append(embed.Fields, discordField{Name: "Platform", Value: event.Platform, Inline: true})
+	}
+	if event.Program != "" {
+		embed.Fields = append(embed.Fields, discordField{Name: "Program", Value: event.Program, Inline: true})
+	}
+	if event.RunID != "" {
+		embed.Footer = &struct {
+			Text string `json:"text"`
+		}{Text: "Run " + event.RunID}
+	}
+
+	description := event.Message
+	if len(event.Assets) > 0 {
+		assets := "```\n" + strings.Join(event.Assets, "\n") + "\n```"
+		if len(description)+len(assets) < discordMaxDescription || attachment != nil {
+			description = strings.TrimSpace(description + "\n" + assets)
+		} else {
+			description = strings.TrimSpace(fmt.Sprintf("%s\n%d assets, full list attached", description, len(event.Assets)))
+			attachment = &events.Attachment{
+				Filename: fmt.Sprintf("%s-%s.txt", event.Kind, event.Timestamp.Format("20060102-150405")),
+				Content:  strings.Join(event.Assets, "\n") + "\n",
+			}
+		}
+	}
+	embed.Description = truncate(description, discordMaxDescription-20)
+
+	return discordPayload{Embeds: []discordEmbed{embed}}, attachment
+}
@@ -0,0 +1,320 @@
+package notifier
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"html"
+	"log"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emailDigestKey holds the events waiting for the next digest, so they survive restarts
+const emailDigestKey = "digest:email"
+
+// EmailNotifier accumulates events and mails them as a digest on a schedule
+type EmailNotifier struct {
+	Client   *redis.Client
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+	StartTLS bool
+	Schedule string // hourly or daily
+	Hour     int    // hour of the day the daily digest is sent
+	// MaxQueued caps the events kept for the digest while the server keeps failing,
+	// the oldest are dropped first, 0 keeps them all
+	MaxQueued int
+}
+
+func (e *EmailNotifier) Name() string {
+	return "email"
+}
+
+// Notify queues the event for the next digest
+func (e *EmailNotifier) Notify(ctx context.Context, event events.Event) error {
+	payload, err := event.Encode()
+	if err != nil {
+		return err
+	}
+	err = e.Client.RPush(ctx, emailDigestKey, payload).Err()
+	if err != nil {
+		return fmt.Errorf("error queueing event for digest: %w", err)
+	}
+	return nil
+}
+
+// nextDigest returns when the digest after now is due
+func (e *EmailNotifier) nextDigest(now time.Time) time.Time {
+	if e.Schedule == "daily" {
+		next := time.Date(now.Year(), now.Month(), now.Day(), e.Hour, 0, 0, 0, now.Location())
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	}
+	return now.Truncate(time.Hour).Add(time.Hour)
+}
+
+// RunDigest sends the queued events on schedule until ctx is done
+func (e *EmailNotifier) RunDigest(ctx context.Context) {
+	for {
+		next := e.nextDigest(time.Now())
+		log.Printf("[email] Next digest at %s", next.Format("2006-01-02 15:04"))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		err := e.Flush(ctx)
+		if err != nil {
+			log.Printf("[email] Error sending digest, kept for the next one: %v", err)
+		}
+	}
+}
+
+// Flush mails the queued events and removes them once the server accepted the mail
+func (e *EmailNotifier) Flush(ctx context.Context) error {
+	payloads, err := e.Client.LRange(ctx, emailDigestKey, 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("error reading digest queue: %w", err)
+	}
+	if len(payloads) == 0 {
+		return nil
+	}
+
+	var queued []events.Event
+	for _, payload := range payloads {
+		queued = append(queued, events.Decode(payload))
+	}
+
+	subject := fmt.Sprintf("Bug bounty digest: %d notifications", len(queued))
+	message, err := e.buildMessage(subject, digestText(queued), digestHTML(queued))
+	if err != nil {
+		return err
+	}
+	err = e.send(message)
+	if err != nil {
+		e.capQueue(ctx)
+		return err
+	}
+
+	// Events queued while sending stay for the next digest
+	err = e.Client.LTrim(ctx, emailDigestKey, int64(len(payloads)), -1).Err()
+	if err != nil {
+		return fmt.Errorf("error trimming digest queue: %w", err)
+	}
+	log.Printf("[email] Digest with %d events sent to %s", len(queued), strings.Join(e.To, ", "))
+	return nil
+}
+
+// capQueue drops the oldest events beyond MaxQueued, so a server that keeps failing
+// does not grow the queue forever
+func (e *EmailNotifier) capQueue(ctx context.Context) {
+	if e.MaxQueued <= 0 {
+		return
+	}
+	dropped, err := e.Client.LLen(ctx, emailDigestKey).Result()
+	if err != nil || dropped <= int64(e.MaxQueued) {
+		return
+	}
+	err = e.Client.LTrim(ctx, emailDigestKey, int64(-e.MaxQueued), -1).Err()
+	if err != nil {
+		log.Printf("[email] Error trimming digest queue: %v", err)
+		return
+	}
+	log.Printf("[email] Dropped the %d oldest events of the digest", dropped-int64(e.MaxQueued))
+}
+
+// send delivers the message, upgrading with STARTTLS and authenticating when configured
+func (e *EmailNotifier) send(message []byte) error {
+	addr := net.JoinHostPort(e.Host, fmt.Sprint(e.Port))
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %w", addr, err)
+	}
+	defer c.Close()
+
+	if e.StartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", addr)
+		}
+		err = c.StartTLS(&tls.Config{ServerName: e.Host})
+		if err != nil {
+			return fmt.Errorf("error starting TLS: %w", err)
+		}
+	}
+	if e.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", e.Username, e.Password, e.Host))
+		if err != nil {
+			return fmt.Errorf("error authenticating: %w", err)
+		}
+	}
+
+	err = c.Mail(e.From)
+	if err != nil {
+		return fmt.Errorf("error setting sender: %w", err)
+	}
+	for _, to := range e.To {
+		err = c.Rcpt(to)
+		if err != nil {
+			return fmt.Errorf("error adding recipient %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("error starting data: %w", err)
+	}
+	_, err = w.Write(message)
+	if err != nil {
+		return fmt.Errorf("error writing message: %w", err)
+	}
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("error sending message: %w", err)
+	}
+	return c.Quit()
+}
+
+// buildMessage returns a multipart/alternative mail with the text and HTML bodies, both
+// quoted-printable so no line exceeds the 998 bytes allowed by RFC 5322
+func (e *EmailNotifier) buildMessage(subject, text, htmlBody string) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", text},
+		{"text/html; charset=UTF-8", htmlBody},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error creating mail part: %w", err)
+		}
+		qp := quotedprintable.NewWriter(w)
+		_, err = qp.Write([]byte(part.content))
+		if err != nil {
+			return nil, fmt.Errorf("error writing mail part: %w", err)
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error writing mail part: %w", err)
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error closing mail body: %w", err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// groupEvents groups events by platform then program, both sorted
+func groupEvents(queued []events.Event) ([]string, map[string][]string, map[string]map[string][]events.Event) {
+	grouped := make(map[string]map[string][]events.Event)
+	for _, event := range queued {
+		platform := event.Platform
+		if platform == "" {
+			platform = "other"
+		}
+		if grouped[platform] == nil {
+			grouped[platform] = make(map[string][]events.Event)
+		}
+		grouped[platform][event.Program] = append(grouped[platform][event.Program], event)
+	}
+
+	var platforms []string
+	programs := make(map[string][]string)
+	for platform, byProgram := range grouped {
+		platforms = append(platforms, platform)
+		for program := range byProgram {
+			programs[platform] = append(programs[platform], program)
+		}
+		sort.Strings(programs[platform])
+	}
+	sort.Strings(platforms)
+	return platforms, programs, grouped
+}
+
+// digestText renders the digest as plain text
+func digestText(queued []events.Event) string {
+	platforms, programs, grouped := groupEvents(queued)
+
+	var sb strings.Builder
+	for _, platform := range platforms {
+		fmt.Fprintf(&sb, "== %s ==\n\n", platform)
+		for _, program := range programs[platform] {
+			if program != "" {
+				fmt.Fprintf(&sb, "-- %s --\n", program)
+			}
+			for _, event := range grouped[platform][program] {
+				fmt.Fprintf(&sb, "[%s] %s\n\n", event.Timestamp.Format("2006-01-02 15:04"), event.Render())
+			}
+		}
+	}
+	return sb.String()
+}
+
+// digestHTML renders the digest as HTML
+func digestHTML(queued []events.Event) string {
+	platforms, programs, grouped := groupEvents(queued)
+
+	var sb strings.Builder
+	sb.WriteString("<html><body style=\"font-family: sans-serif\">\n")
+	for _, platform := range platforms {
+		fmt.Fprintf(&sb, "<h2>%s</h2>\n", html.EscapeString(platform))
+		for _, program := range programs[platform] {
+			if program != "" {
+				name := html.EscapeString(program)
+				if url := events.ProgramURL(platform, program); url != "" {
+					name = fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(url), name)
+				}
+				fmt.Fprintf(&sb, "<h3>%s</h3>\n", name)
+			}
+			for _, event := range grouped[platform][program] {
+				title := event.Title()
+				if event.Kind == events.KindText {
+					title = "Message"
+				}
+				fmt.Fprintf(&sb, "<p><b>%s</b> <small>%s</small></p>\n", html.EscapeString(title), event.Timestamp.Format("2006-01-02 15:04"))
+				if event.Message != "" {
+					fmt.Fprintf(&sb, "<p>%s</p>\n", strings.ReplaceAll(html.EscapeString(event.Message), "\n", "<br>"))
+				}
+				if len(event.Assets) > 0 {
+					sb.WriteString("<ul>\n")
+					for _, asset := range event.Assets {
+						fmt.Fprintf(&sb, "<li><code>%s</code></li>\n", html.EscapeString(asset))
+					}
+					sb.WriteString("</ul>\n")
+				}
+				if event.Attachment != nil {
+					fmt.Fprintf(&sb, "<pre>%s</pre>\n", html.EscapeString(event.Attachment.Content))
+				}
+			}
+		}
+	}
+	sb.WriteString("</body></html>\n")
+	return sb.String()
+}
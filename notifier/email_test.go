@@ -0,0 +1,167 @@
+package notifier
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// smtpStub is an in-process SMTP server that records the mail it accepts and
+// answers RCPT with rcptCode
+type smtpStub struct {
+	listener net.Listener
+	rcptCode int
+	from     string
+	to       []string
+	data     chan []byte
+}
+
+func newSMTPStub(t *testing.T, rcptCode int) *smtpStub {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	stub := &smtpStub{listener: listener, rcptCode: rcptCode, data: make(chan []byte, 1)}
+	t.Cleanup(func() { listener.Close() })
+	go stub.serve()
+	return stub
+}
+
+func (s *smtpStub) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStub) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 stub ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 stub")
+		case "MAIL":
+			s.from = arg
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			s.to = append(s.to, arg)
+			tp.PrintfLine("%d recipient", s.rcptCode)
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.data <- data
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 unknown")
+		}
+	}
+}
+
+func TestEmailSend(t *testing.T) {
+	stub := newSMTPStub(t, 250)
+	e := &EmailNotifier{
+		Host: "127.0.0.1",
+		Port: stub.port(),
+		From: "bot@example.com",
+		To:   []string{"a@example.com", "b@example.com"},
+	}
+
+	// A single asset line far longer than the 998 bytes allowed per line
+	long := strings.Repeat("sub.", 400) + "example.com"
+	message, err := e.buildMessage("Digest", "text "+long+"\n", "<p>"+long+"</p>")
+	if err != nil {
+		t.Fatalf("buildMessage: %v", err)
+	}
+	err = e.send(message)
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	data := <-stub.data
+	if stub.from != "FROM:<bot@example.com>" {
+		t.Errorf("MAIL %s, want FROM:<bot@example.com>", stub.from)
+	}
+	if len(stub.to) != 2 {
+		t.Errorf("RCPT %v, want both recipients", stub.to)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if len(line) > 998 {
+			t.Fatalf("line of %d bytes in the mail, max 998", len(line))
+		}
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if msg.Header.Get("Subject") != "Digest" {
+		t.Errorf("Subject = %q", msg.Header.Get("Subject"))
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("ParseMediaType: %v", err)
+	}
+
+	// Every part decodes back to the full long line
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	parts := 0
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("NextRawPart: %v", err)
+		}
+		if part.Header.Get("Content-Transfer-Encoding") != "quoted-printable" {
+			t.Errorf("part %s is not quoted-printable", part.Header.Get("Content-Type"))
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatalf("decoding part: %v", err)
+		}
+		if !strings.Contains(string(body), long) {
+			t.Errorf("part %s lost the long line", part.Header.Get("Content-Type"))
+		}
+		parts++
+	}
+	if parts != 2 {
+		t.Errorf("%d parts, want text and HTML", parts)
+	}
+}
+
+func TestEmailSendRejected(t *testing.T) {
+	stub := newSMTPStub(t, 550)
+	e := &EmailNotifier{
+		Host: "127.0.0.1",
+		Port: stub.port(),
+		From: "bot@example.com",
+		To:   []string{"nobody@example.com"},
+	}
+	err := e.send([]byte("Subject: x\r\n\r\nbody\r\n"))
+	if err == nil || !strings.Contains(err.Error(), "550") {
+		t.Fatalf("send() error = %v, want the 550 of the server", err)
+	}
+}
@@ -0,0 +1,209 @@
+package notifier
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"BugBountyGoApiWrapper/redismethods"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// legacyGroup is the consumer group that existed before notifiers were pluggable
+const legacyGroup = "telegram"
+
+// Notifier delivers events to a chat tool or any other destination
+type Notifier interface {
+	// Name identifies the notifier, it is also its consumer group on the stream
+	Name() string
+	// Notify delivers the event, retrying transient failures itself
+	Notify(ctx context.Context, event events.Event) error
+}
+
+// Run consumes the notification stream in the consumer group of the notifier, so
+// every notifier receives every event and acknowledges it independently. Events with
+// the same idempotency key within dedupWindow are delivered once, 0 disables it.
+func Run(ctx context.Context, rdb *redis.Client, n Notifier, dedupWindow time.Duration) {
+	// Each process gets its own consumer name, pending messages of a dead one are reclaimed
+	hostname, _ := os.Hostname()
+	consumer := &redismethods.StreamConsumer{
+		Client:        rdb,
+		Stream:        redismethods.NotificationStream,
+		Group:         n.Name(),
+		Consumer:      fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		MaxDeliveries: 5,
+		ClaimIdle:     time.Minute,
+	}
+
+	// New groups only get events published from now on, except the telegram group when
+	// migrating a stream nobody consumed yet, so events published before the upgrade are sent
+	if n.Name() == legacyGroup {
+		hasGroups, err := consumer.HasGroups(ctx)
+		if err != nil {
+			log.Fatal("Error reading consumer groups:", err)
+		}
+		if !hasGroups {
+			consumer.StartID = "0"
+		}
+	}
+
+	err := consumer.EnsureGroup(ctx)
+	if err != nil {
+		log.Fatal("Error joining consumer group:", err)
+	}
+
+	log.Printf("Consuming stream %s as %s/%s", consumer.Stream, consumer.Group, consumer.Consumer)
+
+	var lastReclaim time.Time
+	for {
+		if time.Since(lastReclaim) >= consumer.ClaimIdle/2 {
+			reclaimed, err := consumer.Reclaim(ctx)
+			if err != nil {
+				log.Printf("[%s] Error reclaiming pending messages: %v", n.Name(), err)
+			}
+			for _, msg := range reclaimed {
+				log.Printf("[%s] Retrying message %s (delivery %d)", n.Name(), msg.ID, msg.Deliveries)
+				handleMessage(ctx, consumer, n, msg, dedupWindow)
+			}
+			// Live consumers read every few seconds, an idle one belongs to a dead process
+			pruned, err := consumer.PruneConsumers(ctx, 10*consumer.ClaimIdle)
+			if err != nil {
+				log.Printf("[%s] Error pruning consumers: %v", n.Name(), err)
+			} else if pruned > 0 {
+				log.Printf("[%s] Deleted %d dead consumers", n.Name(), pruned)
+			}
+			// Messages are only trimmed once every backend's group has acknowledged them
+			_, err = consumer.Trim(ctx)
+			if err != nil {
+				log.Printf("[%s] Error trimming stream: %v", n.Name(), err)
+			}
+			lastReclaim = time.Now()
+		}
+
+		messages, err := consumer.Read(ctx, 10, 5*time.Second)
+		if err != nil {
+			log.Printf("[%s] Error reading stream: %v", n.Name(), err)
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, msg := range messages {
+			handleMessage(ctx, consumer, n, msg, dedupWindow)
+		}
+	}
+}
+
+// handleMessage delivers a stream message and acknowledges it once sent.
+// Messages that fail stay pending and are retried when reclaimed.
+func handleMessage(ctx context.Context, consumer *redismethods.StreamConsumer, n Notifier, msg redismethods.StreamMessage, dedupWindow time.Duration) {
+	event := msg.Event()
+
+	if event.Program != "" {
+		until, err := redismethods.MutedUntil(ctx, consumer.Client, event.Program)
+		if err != nil {
+			log.Printf("[%s] Error checking mute for %s: %v", n.Name(), event.Program, err)
+		} else if time.Now().Before(until) {
+			log.Printf("[%s] Dropping message %s, %s is muted until %s", n.Name(), msg.ID, event.Program, until.Format("2006-01-02 15:04"))
+			consumer.Ack(ctx, msg.ID)
+			return
+		}
+	}
+
+	// Filters are read for every message so edits apply right away
+	rules, err := redismethods.GetFilters(ctx, consumer.Client)
+	if err == nil {
+		var deliver bool
+		event, deliver, err = redismethods.FilterEvent(ctx, consumer.Client, rules, event)
+		if err == nil && !deliver {
+			log.Printf("[%s] Dropping message %s, filtered out", n.Name(), msg.ID)
+			consumer.Ack(ctx, msg.ID)
+			return
+		}
+	}
+	if err != nil {
+		log.Printf("[%s] Error applying filters to message %s, delivering it unfiltered: %v", n.Name(), msg.ID, err)
+	}
+
+	// Events from older producers have no key, it is derived the same way
+	key := event.Key
+	if key == "" {
+		key = event.IdempotencyKey()
+	}
+	if dedupWindow > 0 {
+		claimed, err := redismethods.ClaimEvent(ctx, consumer.Client, n.Name(), key, msg.ID, dedupWindow)
+		if err != nil {
+			log.Printf("[%s] Error checking duplicate of message %s: %v", n.Name(), msg.ID, err)
+		} else if !claimed {
+			log.Printf("[%s] Dropping message %s, duplicate of an event delivered in the last %v", n.Name(), msg.ID, dedupWindow)
+			consumer.Ack(ctx, msg.ID)
+			return
+		}
+	}
+
+	err = n.Notify(ctx, event)
+	if err != nil {
+		log.Printf("[%s] Failed to deliver message %s, left pending: %v", n.Name(), msg.ID, err)
+		if dedupWindow > 0 {
+			err = redismethods.ReleaseEvent(ctx, consumer.Client, n.Name(), key, msg.ID)
+			if err != nil {
+				log.Printf("[%s] %v", n.Name(), err)
+			}
+		}
+		return
+	}
+
+	log.Printf("[%s] Message %s delivered", n.Name(), msg.ID)
+	err = consumer.Ack(ctx, msg.ID)
+	if err != nil {
+		log.Printf("[%s] Error acknowledging message %s: %v", n.Name(), msg.ID, err)
+	}
+}
+
+// withRetry calls send up to attempts times with exponential backoff
+func withRetry(attempts int, send func() error) error {
+	retryDelay := time.Second
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = send()
+		if err == nil {
+			return nil
+		}
+
+		log.Printf("Attempt %d failed: %v", attempt, err)
+
+		if attempt < attempts {
+			time.Sleep(retryDelay)
+			retryDelay *= 2 // Exponential backoff
+		}
+	}
+	return err
+}
+
+// post sends body to url and turns a non 2xx response into an error
+func post(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s - %s", req.URL.Host, resp.Status, string(body))
+	}
+	return nil
+}
+
+// postJSON sends data as a JSON body to url
+func postJSON(client *http.Client, url string, data []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return post(client, req)
+}
@@ -0,0 +1,98 @@
+package notifier
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// slackMaxAssets is how many assets are listed before the message is truncated,
+// incoming webhooks can't upload files
+const slackMaxAssets = 50
+
+// slackMaxAttachment is how much of an attachment is inlined in the message
+const slackMaxAttachment = 3000
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// SlackNotifier posts events to a Slack incoming webhook
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func NewSlack(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{WebhookURL: webhookURL, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (s *SlackNotifier) Name() string {
+	return "slack"
+}
+
+func (s *SlackNotifier) Notify(ctx context.Context, event events.Event) error {
+	data, err := json.Marshal(map[string]string{"text": formatSlack(event)})
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %w", err)
+	}
+	return withRetry(3, func() error {
+		return postJSON(s.Client, s.WebhookURL, data)
+	})
+}
+
+// formatSlack renders the event with Slack mrkdwn
+func formatSlack(event events.Event) string {
+	if event.Kind == events.KindText {
+		text := slackEscaper.Replace(event.Message)
+		if event.Attachment != nil {
+			text += "\n```" + truncate(event.Attachment.Content, slackMaxAttachment) + "```"
+		}
+		return text
+	}
+
+	var lines []string
+	title := "*" + slackEscaper.Replace(event.Title()) + "*"
+	if event.Severity == events.SeverityHigh {
+		title += " :rotating_light:"
+	}
+	lines = append(lines, title)
+	if event.Platform != "" {
+		lines = append(lines, "Platform: "+slackEscaper.Replace(event.Platform))
+	}
+	if event.Program != "" {
+		program := slackEscaper.Replace(event.Program)
+		if url := events.ProgramURL(event.Platform, event.Program); url != "" {
+			program = fmt.Sprintf("<%s|%s>", url, program)
+		}
+		lines = append(lines, "Program: "+program)
+	}
+	if event.Message != "" {
+		lines = append(lines, slackEscaper.Replace(event.Message))
+	}
+	if len(event.Assets) > 0 {
+		lines = append(lines, fmt.Sprintf("Assets (%d):", len(event.Assets)))
+		for i, asset := range event.Assets {
+			if i == slackMaxAssets {
+				lines = append(lines, fmt.Sprintf("... and %d more", len(event.Assets)-slackMaxAssets))
+				break
+			}
+			lines = append(lines, "`"+slackEscaper.Replace(asset)+"`")
+		}
+	}
+	if event.Attachment != nil {
+		lines = append(lines, "```"+truncate(event.Attachment.Content, slackMaxAttachment)+"```")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// truncate cuts text to max characters, saying so
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max]) + "\n... (truncated)"
+}
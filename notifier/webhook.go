@@ -0,0 +1,62 @@
+package notifier
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WebhookNotifier posts the JSON event to any URL. When Secret is set the request
+// carries X-Signature: sha256=HMAC-SHA256(secret, timestamp + "." + body) and the
+// X-Timestamp it was computed with, so receivers can verify it and reject replays.
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func NewWebhook(url, secret string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Secret: secret, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (w *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, event events.Event) error {
+	body, err := event.Encode()
+	if err != nil {
+		return err
+	}
+
+	return withRetry(3, func() error {
+		req, err := http.NewRequest("POST", w.URL, bytes.NewReader([]byte(body)))
+		if err != nil {
+			return fmt.Errorf("error creating request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Event-Kind", string(event.Kind))
+
+		if w.Secret != "" {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			req.Header.Set("X-Timestamp", timestamp)
+			req.Header.Set("X-Signature", "sha256="+Sign(w.Secret, timestamp, []byte(body)))
+		}
+		return post(w.Client, req)
+	})
+}
+
+// Sign returns the hex HMAC-SHA256 of timestamp.body, receivers use it to verify requests
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,111 @@
+package redismethods
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// Sources are the producers that record their run status and accept run requests
+var Sources = []string{"hackerone", "intigriti", "subfinder"}
+
+func statusKey(source string) string {
+	return fmt.Sprintf("status:%s", source)
+}
+
+func runRequestsKey(source string) string {
+	return fmt.Sprintf("%s:run_requests", source)
+}
+
+func currentRunKey(source string) string {
+	return fmt.Sprintf("%s:current_run", source)
+}
+
+func muteKey(program string) string {
+	return fmt.Sprintf("mute:%s", program)
+}
+
+// RecordRunStatus saves the time and counters of the last run of a source
+func RecordRunStatus(ctx context.Context, rdb *redis.Client, source string, counts map[string]int) error {
+	fields := map[string]interface{}{"last_run": time.Now().UTC().Format(time.RFC3339)}
+	for name, count := range counts {
+		fields[name] = count
+	}
+	return rdb.HSet(ctx, statusKey(source), fields).Err()
+}
+
+// GetRunStatus returns the fields saved by RecordRunStatus, empty if the source never ran
+func GetRunStatus(ctx context.Context, rdb *redis.Client, source string) (map[string]string, error) {
+	return rdb.HGetAll(ctx, statusKey(source)).Result()
+}
+
+// RequestRun asks a source to start its next run now
+func RequestRun(ctx context.Context, rdb *redis.Client, source string) error {
+	pipe := rdb.TxPipeline()
+	pipe.LPush(ctx, runRequestsKey(source), time.Now().UTC().Format(time.RFC3339))
+	pipe.LTrim(ctx, runRequestsKey(source), 0, 0)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// BeginRun returns the ID of the run of a source that did not finish, so the events it
+// publishes again keep their idempotency keys, or stores and returns a new one
+func BeginRun(ctx context.Context, rdb *redis.Client, source string) string {
+	runID, err := rdb.Get(ctx, currentRunKey(source)).Result()
+	if err == nil {
+		return runID
+	} else if err != redis.Nil {
+		fmt.Printf("Error getting run ID of %s: %v\n", source, err)
+	}
+
+	runID = events.NewRunID()
+	err = rdb.Set(ctx, currentRunKey(source), runID, 0).Err()
+	if err != nil {
+		fmt.Printf("Error saving run ID of %s: %v\n", source, err)
+	}
+	return runID
+}
+
+// FinishRun marks the current run of a source as done, the next one gets a new ID
+func FinishRun(ctx context.Context, rdb *redis.Client, source string) {
+	err := rdb.Del(ctx, currentRunKey(source)).Err()
+	if err != nil {
+		fmt.Printf("Error clearing run ID of %s: %v\n", source, err)
+	}
+}
+
+// WaitForNextRun sleeps for d, or less when a run is requested meanwhile
+func WaitForNextRun(ctx context.Context, rdb *redis.Client, source string, d time.Duration) {
+	_, err := rdb.BLPop(ctx, d, runRequestsKey(source)).Result()
+	if err == nil {
+		fmt.Println("Run requested, starting now")
+	} else if err != redis.Nil {
+		// Redis unavailable, fall back to a plain sleep
+		time.Sleep(d)
+	}
+}
+
+// MuteProgram silences the notifications of a program for d
+func MuteProgram(ctx context.Context, rdb *redis.Client, program string, d time.Duration) error {
+	until := time.Now().Add(d).Unix()
+	return rdb.Set(ctx, muteKey(program), until, d).Err()
+}
+
+// MutedUntil returns when the mute of a program ends, the zero time if it is not muted
+func MutedUntil(ctx context.Context, rdb *redis.Client, program string) (time.Time, error) {
+	data, err := rdb.Get(ctx, muteKey(program)).Result()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	until, err := strconv.ParseInt(data, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid mute for %s: %v", program, err)
+	}
+	return time.Unix(until, 0), nil
+}
@@ -0,0 +1,56 @@
+package redismethods
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+func dedupKey(scope, key string) string {
+	return fmt.Sprintf("dedup:%s:%s", scope, key)
+}
+
+// ClaimEvent marks the event key as handled by the stream message for window with SETNX.
+// It returns false when another message already claimed the key, a redelivery of the
+// same message keeps its claim.
+func ClaimEvent(ctx context.Context, rdb *redis.Client, scope, key, messageID string, window time.Duration) (bool, error) {
+	claimed, err := rdb.SetNX(ctx, dedupKey(scope, key), messageID, window).Result()
+	if err != nil {
+		return false, fmt.Errorf("error claiming event key: %v", err)
+	}
+	if claimed {
+		return true, nil
+	}
+
+	owner, err := rdb.Get(ctx, dedupKey(scope, key)).Result()
+	if err == redis.Nil {
+		// Expired in between, try again
+		return ClaimEvent(ctx, rdb, scope, key, messageID, window)
+	} else if err != nil {
+		return false, fmt.Errorf("error reading event key: %v", err)
+	}
+	return owner == messageID, nil
+}
+
+// ReleaseEvent drops the claim of the message on the event key, so a delivery that failed
+// does not make the next copy of the event look like a duplicate
+func ReleaseEvent(ctx context.Context, rdb *redis.Client, scope, key, messageID string) error {
+	err := rdb.Watch(ctx, func(tx *redis.Tx) error {
+		owner, err := tx.Get(ctx, dedupKey(scope, key)).Result()
+		if err == redis.Nil || owner != messageID {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, dedupKey(scope, key))
+			return nil
+		})
+		return err
+	}, dedupKey(scope, key))
+	if err != nil && err != redis.TxFailedErr {
+		return fmt.Errorf("error releasing event key: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package redismethods
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	filtersKey    = "filters"
+	filtersNextID = "filters:next_id"
+	FilterInclude = "include"
+	FilterExclude = "exclude"
+)
+
+// FilterRule selects events, or assets of events, to include or exclude before delivery.
+// Empty fields match everything and a rule matches when all its set fields match.
+// While include rules exist only what one of them matches is delivered.
+type FilterRule struct {
+	ID           int64     `json:"id"`
+	Action       string    `json:"action"`
+	Kinds        []string  `json:"kinds,omitempty"`
+	Platforms    []string  `json:"platforms,omitempty"`
+	Programs     []string  `json:"programs,omitempty"`
+	AssetPattern string    `json:"asset_pattern,omitempty"`
+	AssetTypes   []string  `json:"asset_types,omitempty"` // wildcard, url, domain, ip or cidr
+	TLDs         []string  `json:"tlds,omitempty"`
+	BountyOnly   bool      `json:"bounty_only,omitempty"`
+	Until        time.Time `json:"until,omitempty"` // the rule expires then, zero never
+
+	assetRegexp *regexp.Regexp
+}
+
+func bountyProgramsKey(platform string) string {
+	return fmt.Sprintf("%s:bounty_programs", platform)
+}
+
+// SaveBountyPrograms replaces the programs of a platform that pay bounties
+func SaveBountyPrograms(ctx context.Context, rdb *redis.Client, platform string, programs []string) error {
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, bountyProgramsKey(platform))
+	if len(programs) > 0 {
+		members := make([]interface{}, len(programs))
+		for i, program := range programs {
+			members[i] = program
+		}
+		pipe.SAdd(ctx, bountyProgramsKey(platform), members...)
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error saving bounty programs to Redis: %v", err)
+	}
+	return nil
+}
+
+// compile checks the rule and compiles its asset pattern
+func (r *FilterRule) compile() error {
+	if r.Action != FilterInclude && r.Action != FilterExclude {
+		return fmt.Errorf("invalid filter action %q, expected include or exclude", r.Action)
+	}
+	if r.AssetPattern != "" {
+		re, err := regexp.Compile(r.AssetPattern)
+		if err != nil {
+			return fmt.Errorf("invalid asset pattern: %v", err)
+		}
+		r.assetRegexp = re
+	}
+	return nil
+}
+
+// AddFilter validates and stores a rule, returning it with its ID
+func AddFilter(ctx context.Context, rdb *redis.Client, rule FilterRule) (FilterRule, error) {
+	err := rule.compile()
+	if err != nil {
+		return rule, err
+	}
+	rule.ID, err = rdb.Incr(ctx, filtersNextID).Result()
+	if err != nil {
+		return rule, fmt.Errorf("error allocating filter ID: %v", err)
+	}
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return rule, fmt.Errorf("error marshaling filter to JSON: %v", err)
+	}
+	err = rdb.HSet(ctx, filtersKey, strconv.FormatInt(rule.ID, 10), data).Err()
+	if err != nil {
+		return rule, fmt.Errorf("error saving filter to Redis: %v", err)
+	}
+	return rule, nil
+}
+
+// RemoveFilter deletes a rule, it returns false when there was no such rule
+func RemoveFilter(ctx context.Context, rdb *redis.Client, id int64) (bool, error) {
+	n, err := rdb.HDel(ctx, filtersKey, strconv.FormatInt(id, 10)).Result()
+	if err != nil {
+		return false, fmt.Errorf("error removing filter from Redis: %v", err)
+	}
+	return n > 0, nil
+}
+
+// GetFilters returns the rules in the order they were added, deleting the expired ones
+func GetFilters(ctx context.Context, rdb *redis.Client) ([]FilterRule, error) {
+	data, err := rdb.HGetAll(ctx, filtersKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting filters from Redis: %v", err)
+	}
+
+	now := time.Now()
+	var rules []FilterRule
+	for id, value := range data {
+		var rule FilterRule
+		err = json.Unmarshal([]byte(value), &rule)
+		if err == nil {
+			err = rule.compile()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %s: %v", id, err)
+		}
+		if !rule.Until.IsZero() && now.After(rule.Until) {
+			rdb.HDel(ctx, filtersKey, id)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules, nil
+}
+
+// AssetType classifies an asset as wildcard, url, cidr, ip or domain
+func AssetType(asset string) string {
+	switch {
+	case strings.HasPrefix(asset, "*"):
+		return "wildcard"
+	case strings.Contains(asset, "://"):
+		return "url"
+	case strings.Contains(asset, "/"):
+		if _, _, err := net.ParseCIDR(asset); err == nil {
+			return "cidr"
+		}
+		return "url"
+	case net.ParseIP(asset) != nil:
+		return "ip"
+	default:
+		return "domain"
+	}
+}
+
+// assetTLD returns the last label of the asset host, empty for addresses
+func assetTLD(asset string) string {
+	host := asset
+	if strings.Contains(host, "://") {
+		if u, err := url.Parse(host); err == nil {
+			host = u.Hostname()
+		}
+	}
+	host = strings.SplitN(host, "/", 2)[0]
+	host = strings.SplitN(host, ":", 2)[0]
+	host = strings.TrimSuffix(host, ".")
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	return strings.ToLower(host[strings.LastIndex(host, ".")+1:])
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAssetCriteria reports whether the rule looks at assets, not only at the event
+func (r *FilterRule) hasAssetCriteria() bool {
+	return r.assetRegexp != nil || len(r.AssetTypes) > 0 || len(r.TLDs) > 0
+}
+
+// matchesEvent checks the event level fields of the rule
+func (r *FilterRule) matchesEvent(event events.Event, bounty bool) bool {
+	return (len(r.Kinds) == 0 || containsFold(r.Kinds, string(event.Kind))) &&
+		(len(r.Platforms) == 0 || containsFold(r.Platforms, event.Platform)) &&
+		(len(r.Programs) == 0 || containsFold(r.Programs, event.Program)) &&
+		(!r.BountyOnly || bounty)
+}
+
+// matchesAsset checks the asset level fields of the rule
+func (r *FilterRule) matchesAsset(asset string) bool {
+	return (r.assetRegexp == nil || r.assetRegexp.MatchString(asset)) &&
+		(len(r.AssetTypes) == 0 || containsFold(r.AssetTypes, AssetType(asset))) &&
+		(len(r.TLDs) == 0 || containsFold(r.TLDs, assetTLD(asset)))
+}
+
+// isBountyProgram reports whether the program pays bounties. Programs of platforms
+// that don't record it, and events without a program, count as paying.
+func isBountyProgram(ctx context.Context, rdb *redis.Client, platform, program string) (bool, error) {
+	if program == "" {
+		return true, nil
+	}
+	pipe := rdb.Pipeline()
+	exists := pipe.Exists(ctx, bountyProgramsKey(platform))
+	member := pipe.SIsMember(ctx, bountyProgramsKey(platform), program)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error checking bounty programs: %v", err)
+	}
+	return exists.Val() == 0 || member.Val(), nil
+}
+
+// FilterEvent applies the rules to the event. It returns the event with the assets
+// that passed, and false when nothing of it is left to deliver.
+func FilterEvent(ctx context.Context, rdb *redis.Client, rules []FilterRule, event events.Event) (events.Event, bool, error) {
+	if len(rules) == 0 {
+		return event, true, nil
+	}
+
+	bounty := true
+	for _, rule := range rules {
+		if rule.BountyOnly {
+			var err error
+			bounty, err = isBountyProgram(ctx, rdb, event.Platform, event.Program)
+			if err != nil {
+				return event, true, err
+			}
+			break
+		}
+	}
+
+	// Rules without asset criteria decide for the whole event, exclusions first. Include
+	// rules with asset criteria only select assets, they don't hold back events without any.
+	hasInclude, hasAssetInclude, included := false, false, false
+	for _, rule := range rules {
+		if rule.hasAssetCriteria() {
+			hasAssetInclude = hasAssetInclude || rule.Action == FilterInclude
+			continue
+		}
+		matches := rule.matchesEvent(event, bounty)
+		if rule.Action == FilterExclude && matches {
+			return event, false, nil
+		}
+		if rule.Action == FilterInclude {
+			hasInclude = true
+			included = included || matches
+		}
+	}
+
+	if len(event.Assets) == 0 {
+		return event, included || !hasInclude, nil
+	}
+
+	var kept []string
+	for _, asset := range event.Assets {
+		keep := included || (!hasInclude && !hasAssetInclude)
+		for _, rule := range rules {
+			if !rule.hasAssetCriteria() || !rule.matchesEvent(event, bounty) || !rule.matchesAsset(asset) {
+				continue
+			}
+			if rule.Action == FilterExclude {
+				keep = false
+				break
+			}
+			keep = true
+		}
+		if keep {
+			kept = append(kept, asset)
+		}
+	}
+	event.Assets = kept
+	return event, len(kept) > 0, nil
+}
@@ -0,0 +1,91 @@
+package redismethods
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestFilterEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []FilterRule
+		event  events.Event
+		assets []string
+		keep   bool
+	}{
+		{
+			name:   "no rules",
+			event:  events.Event{Kind: events.KindAssetsAdded, Assets: []string{"a.com"}},
+			assets: []string{"a.com"},
+			keep:   true,
+		},
+		{
+			name:  "asset-less event under an asset-only include",
+			rules: []FilterRule{{Action: FilterInclude, TLDs: []string{"com"}}},
+			event: events.Event{Kind: events.KindProgramAdded},
+			keep:  true,
+		},
+		{
+			name:   "asset-only include selects assets",
+			rules:  []FilterRule{{Action: FilterInclude, TLDs: []string{"com"}}},
+			event:  events.Event{Kind: events.KindAssetsAdded, Assets: []string{"a.com", "b.io"}},
+			assets: []string{"a.com"},
+			keep:   true,
+		},
+		{
+			name:  "asset-only include matching no asset",
+			rules: []FilterRule{{Action: FilterInclude, TLDs: []string{"com"}}},
+			event: events.Event{Kind: events.KindAssetsAdded, Assets: []string{"b.io"}},
+		},
+		{
+			name:  "event include not matching",
+			rules: []FilterRule{{Action: FilterInclude, Kinds: []string{string(events.KindAssetsRemoved)}}},
+			event: events.Event{Kind: events.KindProgramAdded},
+		},
+		{
+			name: "event include keeps every asset",
+			rules: []FilterRule{
+				{Action: FilterInclude, Programs: []string{"acme"}},
+				{Action: FilterInclude, TLDs: []string{"com"}},
+			},
+			event:  events.Event{Kind: events.KindAssetsAdded, Program: "acme", Assets: []string{"a.com", "b.io"}},
+			assets: []string{"a.com", "b.io"},
+			keep:   true,
+		},
+		{
+			name:  "event exclude",
+			rules: []FilterRule{{Action: FilterExclude, Programs: []string{"acme"}}},
+			event: events.Event{Kind: events.KindAssetsAdded, Program: "acme", Assets: []string{"a.com"}},
+		},
+		{
+			name:   "asset exclude",
+			rules:  []FilterRule{{Action: FilterExclude, AssetPattern: `^dev\.`}},
+			event:  events.Event{Kind: events.KindAssetsAdded, Assets: []string{"dev.a.com", "a.com"}},
+			assets: []string{"a.com"},
+			keep:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.rules {
+				err := tt.rules[i].compile()
+				if err != nil {
+					t.Fatalf("compile: %v", err)
+				}
+			}
+			// No rule is bounty only, Redis is never queried
+			event, keep, err := FilterEvent(context.Background(), nil, tt.rules, tt.event)
+			if err != nil {
+				t.Fatalf("FilterEvent: %v", err)
+			}
+			if keep != tt.keep {
+				t.Errorf("FilterEvent() kept = %v, want %v", keep, tt.keep)
+			}
+			if keep && !reflect.DeepEqual(event.Assets, tt.assets) {
+				t.Errorf("FilterEvent() assets = %v, want %v", event.Assets, tt.assets)
+			}
+		})
+	}
+}
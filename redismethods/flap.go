@@ -0,0 +1,126 @@
+package redismethods
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// FlapConfig controls when a missing asset is reported as removed.
+// An asset is removed after MissingRuns consecutive runs or after MissingFor,
+// whichever comes first. A zero MissingFor disables the time condition.
+type FlapConfig struct {
+	MissingRuns int
+	MissingFor  time.Duration
+}
+
+type missingRecord struct {
+	Since time.Time `json:"since"`
+	Runs  int       `json:"runs"`
+}
+
+func (cfg FlapConfig) expired(record missingRecord, now time.Time) bool {
+	if record.Runs >= cfg.MissingRuns {
+		return true
+	}
+	return cfg.MissingFor > 0 && now.Sub(record.Since) >= cfg.MissingFor
+}
+
+// MissingState is the update of the missing assets computed by ApplyHysteresis
+type MissingState struct {
+	key     string
+	done    []string
+	pending map[string]interface{}
+}
+
+// Commit saves the missing assets, once the changes of the run were published and saved
+func (state *MissingState) Commit(ctx context.Context, rdb *redis.Client) error {
+	pipe := rdb.TxPipeline()
+	if len(state.done) > 0 {
+		pipe.HDel(ctx, state.key, state.done...)
+	}
+	if len(state.pending) > 0 {
+		pipe.HSet(ctx, state.key, state.pending)
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error saving missing assets to Redis: %v", err)
+	}
+	return nil
+}
+
+// ApplyHysteresis filters the added and removed assets of a run so that assets missing
+// from current are only reported as removed once they expire according to cfg.
+// Pending assets are tracked in the missingKey hash, and reappearing ones are dropped
+// from added silently since they were never reported as removed. The hash is only
+// updated by committing the returned state, so a failed run counts again.
+func ApplyHysteresis(ctx context.Context, rdb *redis.Client, missingKey string, cfg FlapConfig, added, removed, current []string, now time.Time) ([]string, []string, *MissingState, error) {
+	data, err := rdb.HGetAll(ctx, missingKey).Result()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	missing := make(map[string]missingRecord, len(data)+len(removed))
+	for asset, raw := range data {
+		var record missingRecord
+		err = json.Unmarshal([]byte(raw), &record)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error unmarshaling missing asset from Redis: %v", err)
+		}
+		missing[asset] = record
+	}
+
+	currentMap := make(map[string]bool)
+	for _, url := range current {
+		currentMap[url] = true
+	}
+
+	// Assets gone since the last run start their missing window now
+	for _, asset := range removed {
+		if _, ok := missing[asset]; !ok {
+			missing[asset] = missingRecord{Since: now.UTC()}
+		}
+	}
+
+	var confirmedAdded, confirmedRemoved, done []string
+	pending := make(map[string]interface{})
+
+	for _, asset := range added {
+		if _, ok := missing[asset]; !ok {
+			confirmedAdded = append(confirmedAdded, asset)
+		}
+	}
+
+	reappeared := 0
+	for asset, record := range missing {
+		if currentMap[asset] {
+			// Back within the window, it was never reported as removed
+			done = append(done, asset)
+			reappeared++
+			continue
+		}
+
+		record.Runs++
+		if cfg.expired(record, now) {
+			confirmedRemoved = append(confirmedRemoved, asset)
+			done = append(done, asset)
+			continue
+		}
+
+		raw, err := json.Marshal(record)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error marshaling missing asset to JSON: %v", err)
+		}
+		pending[asset] = raw
+	}
+
+	if reappeared > 0 {
+		fmt.Printf("Suppressed %d flapping assets that reappeared\n", reappeared)
+	}
+	if len(pending) > 0 {
+		fmt.Printf("%d missing assets pending removal\n", len(pending))
+	}
+
+	return confirmedAdded, confirmedRemoved, &MissingState{key: missingKey, done: done, pending: pending}, nil
+}
@@ -0,0 +1,262 @@
+package redismethods
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// AssetRecord keeps track of when an asset was first and last seen in a program scope
+type AssetRecord struct {
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Present   bool      `json:"present"`
+}
+
+// ScopeChange is a single entry of the append-only change log of a program
+type ScopeChange struct {
+	Time  time.Time `json:"time"`
+	Kind  string    `json:"kind"` // added, removed or readded
+	Asset string    `json:"asset"`
+}
+
+func assetsKey(platform, program string) string {
+	return fmt.Sprintf("%s:assets:%s", platform, program)
+}
+
+func changelogKey(platform, program string) string {
+	return fmt.Sprintf("%s:changelog:%s", platform, program)
+}
+
+func programsKey(platform string) string {
+	return fmt.Sprintf("%s:programs", platform)
+}
+
+// GetAssetRecords retrieves the first/last seen records of every asset of a program
+func GetAssetRecords(ctx context.Context, rdb *redis.Client, platform, program string) (map[string]AssetRecord, error) {
+	data, err := rdb.HGetAll(ctx, assetsKey(platform, program)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]AssetRecord, len(data))
+	for asset, raw := range data {
+		var record AssetRecord
+		err = json.Unmarshal([]byte(raw), &record)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshaling asset record from Redis: %v", err)
+		}
+		records[asset] = record
+	}
+	return records, nil
+}
+
+// RecordScopeHistory updates the asset timestamps of a program with the current scope
+// and appends the detected changes to the program change log. With seed, a program without
+// records gets them without any change logged, its assets were there before it was tracked.
+func RecordScopeHistory(ctx context.Context, rdb *redis.Client, platform, program string, current []string, now time.Time, seed bool) ([]ScopeChange, error) {
+	records, err := GetAssetRecords(ctx, rdb, platform, program)
+	if err != nil {
+		return nil, err
+	}
+	seed = seed && len(records) == 0
+
+	now = now.UTC()
+	var changes []ScopeChange
+	updated := make(map[string]AssetRecord)
+
+	for _, asset := range GetUniqueURLs(current) {
+		record, known := records[asset]
+		switch {
+		case !known:
+			record = AssetRecord{FirstSeen: now}
+			if !seed {
+				changes = append(changes, ScopeChange{Time: now, Kind: "added", Asset: asset})
+			}
+		case !record.Present:
+			changes = append(changes, ScopeChange{Time: now, Kind: "readded", Asset: asset})
+		}
+		record.LastSeen = now
+		record.Present = true
+		updated[asset] = record
+	}
+
+	// Assets that were present but are not anymore keep their last seen time
+	for asset, record := range records {
+		if _, ok := updated[asset]; ok || !record.Present {
+			continue
+		}
+		record.Present = false
+		updated[asset] = record
+		changes = append(changes, ScopeChange{Time: now, Kind: "removed", Asset: asset})
+	}
+
+	pipe := rdb.TxPipeline()
+	fields := make(map[string]interface{}, len(updated))
+	for asset, record := range updated {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling asset record to JSON: %v", err)
+		}
+		fields[asset] = data
+	}
+	if len(fields) > 0 {
+		pipe.HSet(ctx, assetsKey(platform, program), fields)
+	}
+	for _, change := range changes {
+		data, err := json.Marshal(change)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling scope change to JSON: %v", err)
+		}
+		pipe.ZAdd(ctx, changelogKey(platform, program), redis.Z{Score: float64(change.Time.Unix()), Member: data})
+	}
+	pipe.SAdd(ctx, programsKey(platform), program)
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error saving scope history to Redis: %v", err)
+	}
+
+	return changes, nil
+}
+
+// GetProgramChanges returns the change log entries of a program recorded since the given time
+func GetProgramChanges(ctx context.Context, rdb *redis.Client, platform, program string, since time.Time) ([]ScopeChange, error) {
+	data, err := rdb.ZRangeByScore(ctx, changelogKey(platform, program), &redis.ZRangeBy{
+		Min: strconv.FormatInt(since.Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]ScopeChange, 0, len(data))
+	for _, raw := range data {
+		var change ScopeChange
+		err = json.Unmarshal([]byte(raw), &change)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshaling scope change from Redis: %v", err)
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// GetTrackedPrograms returns every program with recorded scope history
+func GetTrackedPrograms(ctx context.Context, rdb *redis.Client, platform string) ([]string, error) {
+	return rdb.SMembers(ctx, programsKey(platform)).Result()
+}
+
+func assetProgramsKey(platform string, asset string) string {
+	return fmt.Sprintf("%s:asset_programs:%s", platform, asset)
+}
+
+// SaveAssetPrograms remembers which programs each asset belongs to, so removed assets
+// can still be attributed to their programs. An asset can be in the scope of several.
+func SaveAssetPrograms(ctx context.Context, rdb *redis.Client, platform string, scopes map[string][]string) error {
+	pipe := rdb.Pipeline()
+	for program, assets := range scopes {
+		for _, asset := range assets {
+			pipe.SAdd(ctx, assetProgramsKey(platform, asset), program)
+		}
+	}
+	if pipe.Len() == 0 {
+		return nil
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error saving asset programs to Redis: %v", err)
+	}
+	return nil
+}
+
+// GroupByProgram groups assets by the programs they belong to, an asset in the scope of
+// several programs is in each of their groups and unknown ones are under ""
+func GroupByProgram(ctx context.Context, rdb *redis.Client, platform string, assets []string) (map[string][]string, error) {
+	groups := make(map[string][]string)
+	if len(assets) == 0 {
+		return groups, nil
+	}
+
+	pipe := rdb.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(assets))
+	for i, asset := range assets {
+		cmds[i] = pipe.SMembers(ctx, assetProgramsKey(platform, asset))
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var unknown []string
+	for i, asset := range assets {
+		programs := cmds[i].Val()
+		if len(programs) == 0 {
+			unknown = append(unknown, asset)
+			continue
+		}
+		for _, program := range programs {
+			groups[program] = append(groups[program], asset)
+		}
+	}
+	if len(unknown) == 0 {
+		return groups, nil
+	}
+
+	// Older versions kept a single program per asset in a hash
+	programs, err := rdb.HMGet(ctx, platform+":asset_programs", unknown...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, asset := range unknown {
+		program, _ := programs[i].(string)
+		groups[program] = append(groups[program], asset)
+	}
+	return groups, nil
+}
+
+func outOfScopeKey(platform string) string {
+	return fmt.Sprintf("%s:out_of_scope", platform)
+}
+
+// SaveOutOfScope replaces the out of scope entries of every program
+func SaveOutOfScope(ctx context.Context, rdb *redis.Client, platform string, outOfScope map[string][]string) error {
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, outOfScopeKey(platform))
+	if len(outOfScope) > 0 {
+		fields := make(map[string]interface{}, len(outOfScope))
+		for program, entries := range outOfScope {
+			data, err := json.Marshal(entries)
+			if err != nil {
+				return fmt.Errorf("error marshaling out of scope entries to JSON: %v", err)
+			}
+			fields[program] = data
+		}
+		pipe.HSet(ctx, outOfScopeKey(platform), fields)
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error saving out of scope entries to Redis: %v", err)
+	}
+	return nil
+}
+
+// GetOutOfScope returns the out of scope entries keyed by program
+func GetOutOfScope(ctx context.Context, rdb *redis.Client, platform string) (map[string][]string, error) {
+	data, err := rdb.HGetAll(ctx, outOfScopeKey(platform)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting out of scope entries from Redis: %v", err)
+	}
+	outOfScope := make(map[string][]string, len(data))
+	for program, value := range data {
+		var entries []string
+		err = json.Unmarshal([]byte(value), &entries)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshaling out of scope entries of %s: %v", program, err)
+		}
+		outOfScope[program] = entries
+	}
+	return outOfScope, nil
+}
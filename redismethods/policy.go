@@ -0,0 +1,127 @@
+package redismethods
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"BugBountyGoApiWrapper/textdiff"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"time"
+)
+
+// maxPolicyVersions is how many policy versions are kept per program
+const maxPolicyVersions = 50
+
+type PolicyVersion struct {
+	Hash      string    `json:"hash"`
+	Text      string    `json:"text"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// PolicyKey returns the Redis key holding the policy versions of a program
+func PolicyKey(platform, handle string) string {
+	return fmt.Sprintf("%s:policy:%s", platform, handle)
+}
+
+// GetLatestPolicy retrieves the most recent stored policy version
+func GetLatestPolicy(ctx context.Context, rdb *redis.Client, key string) (*PolicyVersion, error) {
+	data, err := rdb.LIndex(ctx, key, 0).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var version PolicyVersion
+	err = json.Unmarshal([]byte(data), &version)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling policy from Redis: %v", err)
+	}
+	return &version, nil
+}
+
+// ComparePolicy returns the latest stored version of a policy, nil on first sight, and
+// whether text differs from it. Nothing is stored, see CommitPolicy.
+func ComparePolicy(ctx context.Context, rdb *redis.Client, key string, text string) (*PolicyVersion, bool, error) {
+	previous, err := GetLatestPolicy(ctx, rdb, key)
+	if err != nil {
+		return nil, false, err
+	}
+	return previous, previous == nil || previous.Hash != policyHash(text), nil
+}
+
+// CommitPolicy stores text as the latest policy version
+func CommitPolicy(ctx context.Context, rdb *redis.Client, key string, text string) error {
+	data, err := json.Marshal(PolicyVersion{Hash: policyHash(text), Text: text, FetchedAt: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("error marshaling policy to JSON: %v", err)
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.LPush(ctx, key, data)
+	pipe.LTrim(ctx, key, 0, maxPolicyVersions-1)
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error saving policy to Redis: %v", err)
+	}
+	return nil
+}
+
+// CheckPolicy compares the fetched policy of a program with the stored one and publishes the
+// diff when it changed. The new version is stored only once published, so a failed publish
+// is retried on the next check. Empty policies, usually a failed fetch, are never stored.
+// It returns whether the policy changed.
+func CheckPolicy(ctx context.Context, rdb *redis.Client, platform, handle, runID, text string) (bool, error) {
+	if strings.TrimSpace(text) == "" {
+		return false, fmt.Errorf("empty policy, skipped")
+	}
+	key := PolicyKey(platform, handle)
+	previous, changed, err := ComparePolicy(ctx, rdb, key, text)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	// The first version is only stored, there is nothing to diff it with
+	if previous != nil {
+		err = PublishPolicyDiff(ctx, rdb, platform, handle, runID, previous, text)
+		if err != nil {
+			return false, err
+		}
+	}
+	err = CommitPolicy(ctx, rdb, key, text)
+	if err != nil {
+		return false, err
+	}
+	return previous != nil, nil
+}
+
+func policyHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// PublishPolicyDiff publishes a policy change event with the full unified diff attached
+func PublishPolicyDiff(ctx context.Context, rdb *redis.Client, platform, handle, runID string, previous *PolicyVersion, current string) error {
+	diff, added, removed := textdiff.Diff(
+		fmt.Sprintf("%s/%s %s", platform, handle, previous.FetchedAt.Format(time.RFC3339)),
+		fmt.Sprintf("%s/%s %s", platform, handle, time.Now().UTC().Format(time.RFC3339)),
+		previous.Text, current, 3)
+
+	event := events.New(platform, platform, handle, events.KindPolicyChanged, events.SeverityMedium, runID)
+	event.Message = fmt.Sprintf("Lines added: %d | Lines removed: %d", added, removed)
+	event.Attachment = &events.Attachment{
+		Filename: fmt.Sprintf("%s-%s-policy.diff", platform, handle),
+		Caption:  fmt.Sprintf("Policy diff for %s/%s", platform, handle),
+		Content:  diff,
+	}
+
+	err := PublishEvent(ctx, rdb, event)
+	if err != nil {
+		return fmt.Errorf("error publishing policy diff: %v", err)
+	}
+	return nil
+}
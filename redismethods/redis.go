@@ -29,8 +29,8 @@ func GetUniqueURLs(urls []string) []string {
 }
 
 // getPreviousURLs retrieves the previous unique URLs from Redis as JSON
-func GetPreviousURLs(ctx context.Context, rdb *redis.Client) ([]string, error) {
-	data, err := rdb.Get(ctx, "hackerone:previous_urls").Result()
+func GetPreviousURLs(key string, ctx context.Context, rdb *redis.Client) ([]string, error) {
+	data, err := rdb.Get(ctx, key).Result()
 	if err == redis.Nil {
 		return nil, fmt.Errorf("no previous URLs found")
 	} else if err != nil {
@@ -0,0 +1,162 @@
+package redismethods
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// stageChunkSize is how many members are sent per SADD when staging a set
+const stageChunkSize = 1000
+
+// stageURLs writes urls into a temporary set that expires if the swap never happens
+func stageURLs(ctx context.Context, rdb *redis.Client, key string, urls []string) error {
+	pipe := rdb.Pipeline()
+	for i := 0; i < len(urls); i += stageChunkSize {
+		end := i + stageChunkSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+		members := make([]interface{}, 0, end-i)
+		for _, url := range urls[i:end] {
+			members = append(members, url)
+		}
+		pipe.SAdd(ctx, key, members...)
+	}
+	pipe.Expire(ctx, key, time.Hour)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error staging URLs in Redis: %v", err)
+	}
+	return nil
+}
+
+// existsKey marks that a snapshot was saved at key, Redis deletes sets once they are empty
+func existsKey(key string) string {
+	return key + ":exists"
+}
+
+// GetURLSet retrieves the URLs stored in the set at key
+func GetURLSet(ctx context.Context, rdb *redis.Client, key string) ([]string, error) {
+	kind, err := rdb.Type(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case "none":
+		saved, err := rdb.Exists(ctx, existsKey(key)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if saved > 0 {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("no previous URLs found")
+	case "string":
+		// Snapshot saved as a JSON blob by an older version
+		return GetPreviousURLs(key, ctx, rdb)
+	}
+	return rdb.SMembers(ctx, key).Result()
+}
+
+// URLSetExists reports whether a set was ever saved at key, even an empty one
+func URLSetExists(ctx context.Context, rdb *redis.Client, key string) (bool, error) {
+	count, err := rdb.Exists(ctx, key, existsKey(key)).Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// DeleteURLSet deletes the set at key, after which it was never saved
+func DeleteURLSet(ctx context.Context, rdb *redis.Client, key string) error {
+	err := rdb.Del(ctx, key, existsKey(key)).Err()
+	if err != nil {
+		return fmt.Errorf("error deleting URL set from Redis: %v", err)
+	}
+	return nil
+}
+
+// SwapURLSet replaces the set at key with urls and returns the added and removed URLs.
+// existed reports whether there was a previous set to compare with.
+func SwapURLSet(ctx context.Context, rdb *redis.Client, key string, urls []string) (added []string, removed []string, existed bool, err error) {
+	err = CompareAndSwapURLSet(ctx, rdb, key, urls, func(a []string, r []string, found bool) error {
+		added, removed, existed = a, r, found
+		return nil
+	})
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return added, removed, existed, nil
+}
+
+// CompareAndSwapURLSet computes the URLs added to and removed from the set at key with SDIFF
+// and passes them to commit. The set is only replaced by urls once commit returns nil, in a
+// MULTI/EXEC watching key, so it fails with redis.TxFailedErr when another writer replaced
+// the set in between. existed reports whether there was a previous set to compare with.
+func CompareAndSwapURLSet(ctx context.Context, rdb *redis.Client, key string, urls []string, commit func(added []string, removed []string, existed bool) error) error {
+	urls = GetUniqueURLs(urls)
+	staging := fmt.Sprintf("%s:staging:%d", key, time.Now().UnixNano())
+	if len(urls) > 0 {
+		err := stageURLs(ctx, rdb, staging, urls)
+		if err != nil {
+			return err
+		}
+		// Already renamed over key when the swap succeeds
+		defer rdb.Del(ctx, staging)
+	}
+
+	return rdb.Watch(ctx, func(tx *redis.Tx) error {
+		kind, err := tx.Type(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		saved, err := tx.Exists(ctx, existsKey(key)).Result()
+		if err != nil {
+			return err
+		}
+
+		var added, removed []string
+		if kind == "string" {
+			// Snapshot saved as a JSON blob by an older version, compared client side one last time
+			previous, err := GetPreviousURLs(key, ctx, rdb)
+			if err != nil {
+				return err
+			}
+			added, removed = CompareUniqueURLs(previous, urls)
+		} else {
+			// A missing staging set is empty, every previous URL is removed
+			added, err = tx.SDiff(ctx, staging, key).Result()
+			if err != nil {
+				return fmt.Errorf("error comparing URL sets in Redis: %v", err)
+			}
+			removed, err = tx.SDiff(ctx, key, staging).Result()
+			if err != nil {
+				return fmt.Errorf("error comparing URL sets in Redis: %v", err)
+			}
+		}
+
+		err = commit(added, removed, kind != "none" || saved > 0)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if len(urls) == 0 {
+				pipe.Del(ctx, key)
+			} else {
+				pipe.Rename(ctx, staging, key)
+				pipe.Persist(ctx, key)
+			}
+			pipe.Set(ctx, existsKey(key), 1, 0)
+			return nil
+		})
+		if err == redis.TxFailedErr {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("error swapping URL set in Redis: %v", err)
+		}
+		return nil
+	}, key, existsKey(key))
+}
@@ -0,0 +1,297 @@
+package redismethods
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// NotificationStream is the Redis Stream every producer writes its notifications to
+	NotificationStream = "notifications"
+	// DeadLetterStream receives the notifications that could not be delivered after MaxDeliveries
+	DeadLetterStream = "notifications:dead"
+
+	// maxStreamLength only guards against a group that stopped reading for good, it is far
+	// above any backlog since trimming by length can drop messages not delivered yet. The
+	// stream is kept short by Trim, up to what every group has acknowledged.
+	maxStreamLength = 100000
+	// maxDeadLetters is how many undeliverable messages are kept for inspection
+	maxDeadLetters = 10000
+)
+
+// StreamMessage is a notification read from the stream
+type StreamMessage struct {
+	ID         string
+	Type       string // event, or message and document from older producers
+	Payload    string
+	Deliveries int64
+}
+
+// PublishEvent appends a JSON event to the notification stream
+func PublishEvent(ctx context.Context, rdb *redis.Client, event events.Event) error {
+	if event.Key == "" {
+		event.Key = event.IdempotencyKey()
+	}
+	payload, err := event.Encode()
+	if err != nil {
+		return err
+	}
+	return publishToStream(ctx, rdb, "event", payload)
+}
+
+// Event converts the message to an event, whatever the producer version
+func (m StreamMessage) Event() events.Event {
+	switch m.Type {
+	case "event":
+		return events.Decode(m.Payload)
+	case "document":
+		var attachment events.Attachment
+		err := json.Unmarshal([]byte(m.Payload), &attachment)
+		if err != nil {
+			return events.FromText(m.Payload)
+		}
+		event := events.FromText(attachment.Caption)
+		event.Attachment = &attachment
+		return event
+	default:
+		return events.FromText(m.Payload)
+	}
+}
+
+func publishToStream(ctx context.Context, rdb *redis.Client, kind, payload string) error {
+	err := rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: NotificationStream,
+		MaxLen: maxStreamLength,
+		Approx: true,
+		Values: map[string]interface{}{"type": kind, "payload": payload},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("error publishing to stream: %v", err)
+	}
+	return nil
+}
+
+// StreamConsumer reads the notification stream as a member of a consumer group
+type StreamConsumer struct {
+	Client        *redis.Client
+	Stream        string
+	Group         string
+	Consumer      string
+	MaxDeliveries int64         // deliveries before a message is moved to the dead-letter stream
+	ClaimIdle     time.Duration // idle time before a pending message is reclaimed from its consumer
+	StartID       string        // where a new group starts reading, "$" (new messages only) when empty
+}
+
+// EnsureGroup creates the consumer group, and the stream if needed
+func (c *StreamConsumer) EnsureGroup(ctx context.Context) error {
+	start := c.StartID
+	if start == "" {
+		start = "$"
+	}
+	err := c.Client.XGroupCreateMkStream(ctx, c.Stream, c.Group, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("error creating consumer group: %v", err)
+	}
+	return nil
+}
+
+// HasGroups reports whether any consumer group reads the stream
+func (c *StreamConsumer) HasGroups(ctx context.Context) (bool, error) {
+	groups, err := c.Client.XInfoGroups(ctx, c.Stream).Result()
+	if err != nil && strings.HasPrefix(err.Error(), "ERR no such key") {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error getting consumer groups: %v", err)
+	}
+	return len(groups) > 0, nil
+}
+
+// Read blocks up to block for new messages delivered to this consumer
+func (c *StreamConsumer) Read(ctx context.Context, count int64, block time.Duration) ([]StreamMessage, error) {
+	streams, err := c.Client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.Group,
+		Consumer: c.Consumer,
+		Streams:  []string{c.Stream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var messages []StreamMessage
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			messages = append(messages, toStreamMessage(msg, 1))
+		}
+	}
+	return messages, nil
+}
+
+// Ack acknowledges a message once it was delivered
+func (c *StreamConsumer) Ack(ctx context.Context, id string) error {
+	return c.Client.XAck(ctx, c.Stream, c.Group, id).Err()
+}
+
+// Reclaim claims the messages left pending for ClaimIdle, by a crashed consumer or a failed
+// delivery. Messages already delivered MaxDeliveries times go to the dead-letter stream.
+func (c *StreamConsumer) Reclaim(ctx context.Context) ([]StreamMessage, error) {
+	pending, err := c.Client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.Stream,
+		Group:  c.Group,
+		Idle:   c.ClaimIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make(map[string]int64)
+	var ids []string
+	for _, entry := range pending {
+		if entry.RetryCount >= c.MaxDeliveries {
+			err = c.deadLetter(ctx, entry.ID, entry.RetryCount)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		deliveries[entry.ID] = entry.RetryCount + 1
+		ids = append(ids, entry.ID)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	claimed, err := c.Client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   c.Stream,
+		Group:    c.Group,
+		Consumer: c.Consumer,
+		MinIdle:  c.ClaimIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]StreamMessage, 0, len(claimed))
+	for _, msg := range claimed {
+		messages = append(messages, toStreamMessage(msg, deliveries[msg.ID]))
+	}
+	return messages, nil
+}
+
+// PruneConsumers deletes the other consumers of the group that have nothing pending and were
+// idle for at least idle, the ones left behind by restarted processes once Reclaim took their
+// messages. It returns how many were deleted.
+func (c *StreamConsumer) PruneConsumers(ctx context.Context, idle time.Duration) (int, error) {
+	consumers, err := c.Client.XInfoConsumers(ctx, c.Stream, c.Group).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, consumer := range consumers {
+		if consumer.Name == c.Consumer || consumer.Pending > 0 || consumer.Idle < idle {
+			continue
+		}
+		err = c.Client.XGroupDelConsumer(ctx, c.Stream, c.Group, consumer.Name).Err()
+		if err != nil {
+			return deleted, fmt.Errorf("error deleting consumer %s: %v", consumer.Name, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Trim deletes the messages every group of the stream has acknowledged: those before the
+// oldest pending message of each group, or before the last one it read when none is pending.
+// It returns how many were deleted.
+func (c *StreamConsumer) Trim(ctx context.Context) (int64, error) {
+	groups, err := c.Client.XInfoGroups(ctx, c.Stream).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error getting consumer groups: %v", err)
+	}
+
+	minID := ""
+	for _, group := range groups {
+		id := group.LastDeliveredID
+		if group.Pending > 0 {
+			pending, err := c.Client.XPending(ctx, c.Stream, group.Name).Result()
+			if err != nil {
+				return 0, fmt.Errorf("error getting pending messages of %s: %v", group.Name, err)
+			}
+			id = pending.Lower
+		}
+		if minID == "" || compareStreamIDs(id, minID) < 0 {
+			minID = id
+		}
+	}
+	if minID == "" {
+		return 0, nil
+	}
+	return c.Client.XTrimMinID(ctx, c.Stream, minID).Result()
+}
+
+// compareStreamIDs compares two stream IDs, <ms>-<seq>, like strings.Compare
+func compareStreamIDs(a, b string) int {
+	aMs, aSeq := parseStreamID(a)
+	bMs, bSeq := parseStreamID(b)
+	switch {
+	case aMs < bMs || (aMs == bMs && aSeq < bSeq):
+		return -1
+	case aMs == bMs && aSeq == bSeq:
+		return 0
+	}
+	return 1
+}
+
+func parseStreamID(id string) (uint64, uint64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	msValue, _ := strconv.ParseUint(ms, 10, 64)
+	seqValue, _ := strconv.ParseUint(seq, 10, 64)
+	return msValue, seqValue
+}
+
+// deadLetter copies a message to the dead-letter stream and acknowledges it
+func (c *StreamConsumer) deadLetter(ctx context.Context, id string, deliveries int64) error {
+	msgs, err := c.Client.XRange(ctx, c.Stream, id, id).Result()
+	if err != nil {
+		return err
+	}
+
+	if len(msgs) > 0 {
+		values := msgs[0].Values
+		values["original_id"] = id
+		values["group"] = c.Group
+		values["deliveries"] = deliveries
+		err = c.Client.XAdd(ctx, &redis.XAddArgs{
+			Stream: DeadLetterStream,
+			MaxLen: maxDeadLetters,
+			Approx: true,
+			Values: values,
+		}).Err()
+		if err != nil {
+			return fmt.Errorf("error moving message to dead-letter stream: %v", err)
+		}
+	}
+
+	fmt.Printf("Message %s moved to %s after %d deliveries\n", id, DeadLetterStream, deliveries)
+	return c.Ack(ctx, id)
+}
+
+func toStreamMessage(msg redis.XMessage, deliveries int64) StreamMessage {
+	kind, _ := msg.Values["type"].(string)
+	payload, _ := msg.Values["payload"].(string)
+	return StreamMessage{ID: msg.ID, Type: kind, Payload: payload, Deliveries: deliveries}
+}
@@ -0,0 +1,23 @@
+package redismethods
+
+import "testing"
+
+func TestCompareStreamIDs(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1-0", "1-0", 0},
+		{"1-0", "1-1", -1},
+		{"2-0", "1-9", 1},
+		// Compared as numbers, not as strings
+		{"9-0", "10-0", -1},
+		{"5-10", "5-9", 1},
+		{"0-0", "1700000000000-0", -1},
+	}
+	for _, tt := range tests {
+		if got := compareStreamIDs(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareStreamIDs(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package redismethods
+
+import (
+	"BugBountyGoApiWrapper/subdomains"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	subdomainSourcesKey = "subfinder:sources"
+	subdomainDNSKey     = "subfinder:dns"
+	subdomainHTTPKey    = "subfinder:http"
+	takeoversKey        = "subfinder:takeovers"
+	activeProgramsKey   = "subfinder:active_programs"
+)
+
+// SaveSubdomainSources stores which sources reported each subdomain
+func SaveSubdomainSources(ctx context.Context, rdb *redis.Client, sources map[string][]string) error {
+	fields := make(map[string]interface{}, len(sources))
+	for subdomain, names := range sources {
+		fields[subdomain] = names
+	}
+	err := saveSubdomainFields(ctx, rdb, subdomainSourcesKey, fields)
+	if err != nil {
+		return fmt.Errorf("error saving subdomain sources: %w", err)
+	}
+	return nil
+}
+
+// GetSubdomainSources returns the sources that reported the subdomains, nil for unknown ones
+func GetSubdomainSources(ctx context.Context, rdb *redis.Client, hosts []string) (map[string][]string, error) {
+	sources := make(map[string][]string, len(hosts))
+	err := getSubdomainFields(ctx, rdb, subdomainSourcesKey, hosts, func(host, data string) {
+		var names []string
+		if json.Unmarshal([]byte(data), &names) == nil {
+			sources[host] = names
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting subdomain sources: %w", err)
+	}
+	return sources, nil
+}
+
+// SaveResolutions stores the last DNS resolution of each subdomain
+func SaveResolutions(ctx context.Context, rdb *redis.Client, resolutions map[string]subdomains.Resolution) error {
+	fields := make(map[string]interface{}, len(resolutions))
+	for host, resolution := range resolutions {
+		fields[host] = resolution
+	}
+	err := saveSubdomainFields(ctx, rdb, subdomainDNSKey, fields)
+	if err != nil {
+		return fmt.Errorf("error saving resolutions: %w", err)
+	}
+	return nil
+}
+
+// GetResolutions returns the last DNS resolution of the subdomains, hosts never resolved are missing
+func GetResolutions(ctx context.Context, rdb *redis.Client, hosts []string) (map[string]subdomains.Resolution, error) {
+	resolutions := make(map[string]subdomains.Resolution, len(hosts))
+	err := getSubdomainFields(ctx, rdb, subdomainDNSKey, hosts, func(host, data string) {
+		var resolution subdomains.Resolution
+		if json.Unmarshal([]byte(data), &resolution) == nil {
+			resolutions[host] = resolution
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting resolutions: %w", err)
+	}
+	return resolutions, nil
+}
+
+// SaveProbes stores the endpoints that answered on each subdomain
+func SaveProbes(ctx context.Context, rdb *redis.Client, probes map[string][]subdomains.ProbeResult) error {
+	fields := make(map[string]interface{}, len(probes))
+	for host, results := range probes {
+		fields[host] = results
+	}
+	err := saveSubdomainFields(ctx, rdb, subdomainHTTPKey, fields)
+	if err != nil {
+		return fmt.Errorf("error saving probes: %w", err)
+	}
+	return nil
+}
+
+// GetProbes returns the endpoints that answered on the subdomains when they were last probed
+func GetProbes(ctx context.Context, rdb *redis.Client, hosts []string) (map[string][]subdomains.ProbeResult, error) {
+	probes := make(map[string][]subdomains.ProbeResult, len(hosts))
+	err := getSubdomainFields(ctx, rdb, subdomainHTTPKey, hosts, func(host, data string) {
+		var results []subdomains.ProbeResult
+		if json.Unmarshal([]byte(data), &results) == nil {
+			probes[host] = results
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting probes: %w", err)
+	}
+	return probes, nil
+}
+
+// SaveTakeovers stores the takeover candidates
+func SaveTakeovers(ctx context.Context, rdb *redis.Client, candidates map[string]subdomains.TakeoverCandidate) error {
+	fields := make(map[string]interface{}, len(candidates))
+	for host, candidate := range candidates {
+		fields[host] = candidate
+	}
+	err := saveSubdomainFields(ctx, rdb, takeoversKey, fields)
+	if err != nil {
+		return fmt.Errorf("error saving takeover candidates: %w", err)
+	}
+	return nil
+}
+
+// GetTakeovers returns the takeover candidates found so far, keyed by host
+func GetTakeovers(ctx context.Context, rdb *redis.Client) (map[string]subdomains.TakeoverCandidate, error) {
+	data, err := rdb.HGetAll(ctx, takeoversKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting takeover candidates from Redis: %v", err)
+	}
+	candidates := make(map[string]subdomains.TakeoverCandidate, len(data))
+	for host, raw := range data {
+		var candidate subdomains.TakeoverCandidate
+		if json.Unmarshal([]byte(raw), &candidate) == nil {
+			candidates[host] = candidate
+		}
+	}
+	return candidates, nil
+}
+
+// RemoveTakeovers forgets the candidates of hosts that can no longer be taken over
+func RemoveTakeovers(ctx context.Context, rdb *redis.Client, hosts []string) error {
+	if len(hosts) == 0 {
+		return nil
+	}
+	err := rdb.HDel(ctx, takeoversKey, hosts...).Err()
+	if err != nil {
+		return fmt.Errorf("error removing takeover candidates from Redis: %v", err)
+	}
+	return nil
+}
+
+// SetActiveEnumeration opts a program in or out of active enumeration, off by default
+// because some programs prohibit bruteforcing
+func SetActiveEnumeration(ctx context.Context, rdb *redis.Client, program string, enabled bool) error {
+	var err error
+	if enabled {
+		err = rdb.SAdd(ctx, activeProgramsKey, program).Err()
+	} else {
+		err = rdb.SRem(ctx, activeProgramsKey, program).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("error saving active enumeration of %s to Redis: %v", program, err)
+	}
+	return nil
+}
+
+// GetActivePrograms returns the programs opted in to active enumeration
+func GetActivePrograms(ctx context.Context, rdb *redis.Client) ([]string, error) {
+	programs, err := rdb.SMembers(ctx, activeProgramsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting active programs from Redis: %v", err)
+	}
+	return programs, nil
+}
+
+// saveSubdomainFields stores the values as JSON in the hash key, one field per subdomain
+func saveSubdomainFields(ctx context.Context, rdb *redis.Client, key string, values map[string]interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+	fields := make(map[string]interface{}, len(values))
+	for subdomain, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("error marshaling %s to JSON: %v", subdomain, err)
+		}
+		fields[subdomain] = data
+	}
+	err := rdb.HSet(ctx, key, fields).Err()
+	if err != nil {
+		return fmt.Errorf("error saving %s to Redis: %v", key, err)
+	}
+	return nil
+}
+
+// getSubdomainFields calls decode with the JSON stored for every host found in the hash key
+func getSubdomainFields(ctx context.Context, rdb *redis.Client, key string, hosts []string, decode func(host, data string)) error {
+	if len(hosts) == 0 {
+		return nil
+	}
+	values, err := rdb.HMGet(ctx, key, hosts...).Result()
+	if err != nil {
+		return fmt.Errorf("error getting %s from Redis: %v", key, err)
+	}
+	for i, value := range values {
+		if data, ok := value.(string); ok {
+			decode(hosts[i], data)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"BugBountyGoApiWrapper/redismethods"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore keeps one JSON file per namespace holding the snapshot history, most recent first
+type FileStore struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating snapshot directory: %w", err)
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+func (s *FileStore) path(namespace string) string {
+	name := strings.NewReplacer(":", "_", "/", "_", "\\", "_").Replace(namespace)
+	return filepath.Join(s.Dir, name+".json")
+}
+
+func (s *FileStore) read(namespace string) ([]Snapshot, error) {
+	data, err := os.ReadFile(s.path(namespace))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading snapshot file: %w", err)
+	}
+
+	var snapshots []Snapshot
+	err = json.Unmarshal(data, &snapshots)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling snapshot file: %w", err)
+	}
+	return snapshots, nil
+}
+
+func (s *FileStore) Load(ctx context.Context, namespace string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshots, err := s.read(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, ErrNoSnapshot
+	}
+	return snapshots[0].Items, nil
+}
+
+func (s *FileStore) Save(ctx context.Context, namespace string, items []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshots, err := s.read(namespace)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) > 0 && unchanged(snapshots[0].Items, items) {
+		return nil
+	}
+	return s.write(namespace, snapshots, items)
+}
+
+// write prepends items to the snapshots of namespace and replaces its file
+func (s *FileStore) write(namespace string, snapshots []Snapshot, items []string) error {
+	snapshots = append([]Snapshot{{Time: time.Now().UTC(), Items: items}}, snapshots...)
+	if len(snapshots) > maxHistory {
+		snapshots = snapshots[:maxHistory]
+	}
+
+	data, err := json.Marshal(snapshots)
+	if err != nil {
+		return fmt.Errorf("error marshaling snapshots to JSON: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated snapshot
+	tmp := s.path(namespace) + ".tmp"
+	err = os.WriteFile(tmp, data, 0o644)
+	if err != nil {
+		return fmt.Errorf("error writing snapshot file: %w", err)
+	}
+	err = os.Rename(tmp, s.path(namespace))
+	if err != nil {
+		return fmt.Errorf("error replacing snapshot file: %w", err)
+	}
+	return nil
+}
+
+// Update holds the store lock while publishing, the files are not shared between processes
+func (s *FileStore) Update(ctx context.Context, namespace string, items []string, publish func(added []string, removed []string) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshots, err := s.read(namespace)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		err = s.write(namespace, snapshots, items)
+		if err != nil {
+			return err
+		}
+		return ErrNoSnapshot
+	}
+
+	added, removed := redismethods.CompareUniqueURLs(snapshots[0].Items, items)
+	err = publish(added, removed)
+	if err != nil {
+		return err
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	return s.write(namespace, snapshots, items)
+}
+
+func (s *FileStore) SaveAndDiff(ctx context.Context, namespace string, items []string) ([]string, []string, error) {
+	return saveAndDiff(ctx, s, namespace, items)
+}
+
+func (s *FileStore) Delete(ctx context.Context, namespace string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path(namespace))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting snapshot file: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) History(ctx context.Context, namespace string, limit int) ([]Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshots, err := s.read(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) > limit {
+		snapshots = snapshots[:limit]
+	}
+	return snapshots, nil
+}
+
+// Close does nothing, files are not kept open
+func (s *FileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"BugBountyGoApiWrapper/redismethods"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// RedisStore keeps the latest snapshot as a set under the namespace key and the history in namespace:history
+type RedisStore struct {
+	Client *redis.Client
+}
+
+func (s *RedisStore) Load(ctx context.Context, namespace string) ([]string, error) {
+	exists, err := redismethods.URLSetExists(ctx, s.Client, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNoSnapshot
+	}
+	return redismethods.GetURLSet(ctx, s.Client, namespace)
+}
+
+func (s *RedisStore) Save(ctx context.Context, namespace string, items []string) error {
+	_, _, err := s.SaveAndDiff(ctx, namespace, items)
+	if err == ErrNoSnapshot {
+		return nil
+	}
+	return err
+}
+
+func (s *RedisStore) SaveAndDiff(ctx context.Context, namespace string, items []string) ([]string, []string, error) {
+	return saveAndDiff(ctx, s, namespace, items)
+}
+
+func (s *RedisStore) Update(ctx context.Context, namespace string, items []string, publish func(added []string, removed []string) error) error {
+	var existed, changed bool
+	err := redismethods.CompareAndSwapURLSet(ctx, s.Client, namespace, items, func(added []string, removed []string, found bool) error {
+		existed, changed = found, len(added) > 0 || len(removed) > 0
+		if !found {
+			return nil
+		}
+		return publish(added, removed)
+	})
+	if err == redis.TxFailedErr {
+		return ErrConflict
+	} else if err != nil {
+		return err
+	}
+
+	// Only snapshots that differ from the previous one are kept in the history
+	if !existed || changed {
+		data, err := json.Marshal(Snapshot{Time: time.Now().UTC(), Items: items})
+		if err != nil {
+			return fmt.Errorf("error marshaling snapshot to JSON: %v", err)
+		}
+		pipe := s.Client.TxPipeline()
+		pipe.LPush(ctx, namespace+":history", data)
+		pipe.LTrim(ctx, namespace+":history", 0, maxHistory-1)
+		_, err = pipe.Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error saving snapshot history to Redis: %v", err)
+		}
+	}
+
+	if !existed {
+		return ErrNoSnapshot
+	}
+	return nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, namespace string) error {
+	err := redismethods.DeleteURLSet(ctx, s.Client, namespace)
+	if err != nil {
+		return err
+	}
+	return s.Client.Del(ctx, namespace+":history").Err()
+}
+
+func (s *RedisStore) History(ctx context.Context, namespace string, limit int) ([]Snapshot, error) {
+	data, err := s.Client.LRange(ctx, namespace+":history", 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]Snapshot, 0, len(data))
+	for _, raw := range data {
+		var snapshot Snapshot
+		err = json.Unmarshal([]byte(raw), &snapshot)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshaling snapshot from Redis: %v", err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// Close does nothing, the client belongs to the caller
+func (s *RedisStore) Close() error {
+	return nil
+}
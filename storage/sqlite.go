@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"BugBountyGoApiWrapper/redismethods"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	_ "modernc.org/sqlite"
+	"strings"
+	"time"
+)
+
+// SQLiteStore keeps every snapshot as a row, the latest one being the current state
+type SQLiteStore struct {
+	DB *sql.DB
+}
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	// Wait for the lock of another connection instead of failing with SQLITE_BUSY, and let
+	// readers work while a snapshot is written
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open("sqlite", path+separator+"_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("error opening SQLite database: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		namespace TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		items TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS snapshots_namespace ON snapshots (namespace, id)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating snapshots table: %w", err)
+	}
+
+	return &SQLiteStore{DB: db}, nil
+}
+
+func (s *SQLiteStore) Load(ctx context.Context, namespace string) ([]string, error) {
+	_, items, err := s.latest(ctx, namespace)
+	return items, err
+}
+
+// latest returns the id and items of the latest snapshot of namespace
+func (s *SQLiteStore) latest(ctx context.Context, namespace string) (int64, []string, error) {
+	var id int64
+	var data string
+	err := s.DB.QueryRowContext(ctx,
+		`SELECT id, items FROM snapshots WHERE namespace = ? ORDER BY id DESC LIMIT 1`, namespace).Scan(&id, &data)
+	if err == sql.ErrNoRows {
+		return 0, nil, ErrNoSnapshot
+	} else if err != nil {
+		return 0, nil, fmt.Errorf("error loading snapshot: %w", err)
+	}
+
+	var items []string
+	err = json.Unmarshal([]byte(data), &items)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error unmarshaling snapshot: %w", err)
+	}
+	return id, items, nil
+}
+
+func (s *SQLiteStore) Save(ctx context.Context, namespace string, items []string) error {
+	_, previous, err := s.latest(ctx, namespace)
+	if err != nil && err != ErrNoSnapshot {
+		return err
+	}
+	if err == nil && unchanged(previous, items) {
+		return nil
+	}
+	return s.insert(ctx, namespace, items, -1)
+}
+
+// insert saves items as the latest snapshot. Unless latest is negative, it only does so
+// while latest is still the id of the latest snapshot, 0 meaning none, or returns ErrConflict.
+func (s *SQLiteStore) insert(ctx context.Context, namespace string, items []string, latest int64) error {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return fmt.Errorf("error marshaling snapshot to JSON: %w", err)
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO snapshots (namespace, created_at, items) SELECT ?, ?, ?
+		WHERE ? < 0 OR COALESCE((SELECT MAX(id) FROM snapshots WHERE namespace = ?), 0) = ?`,
+		namespace, time.Now().UTC().UnixNano(), string(data), latest, namespace, latest)
+	if err != nil {
+		return fmt.Errorf("error saving snapshot: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error saving snapshot: %w", err)
+	}
+	if inserted == 0 {
+		return ErrConflict
+	}
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM snapshots WHERE namespace = ? AND id NOT IN (
+			SELECT id FROM snapshots WHERE namespace = ? ORDER BY id DESC LIMIT ?)`,
+		namespace, namespace, maxHistory)
+	if err != nil {
+		return fmt.Errorf("error trimming snapshot history: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Update saves items only if no other writer inserted a snapshot while publishing
+func (s *SQLiteStore) Update(ctx context.Context, namespace string, items []string, publish func(added []string, removed []string) error) error {
+	id, previous, err := s.latest(ctx, namespace)
+	if err == ErrNoSnapshot {
+		err = s.insert(ctx, namespace, items, 0)
+		if err != nil {
+			return err
+		}
+		return ErrNoSnapshot
+	} else if err != nil {
+		return err
+	}
+
+	added, removed := redismethods.CompareUniqueURLs(previous, items)
+	err = publish(added, removed)
+	if err != nil {
+		return err
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	return s.insert(ctx, namespace, items, id)
+}
+
+func (s *SQLiteStore) SaveAndDiff(ctx context.Context, namespace string, items []string) ([]string, []string, error) {
+	return saveAndDiff(ctx, s, namespace, items)
+}
+
+func (s *SQLiteStore) Delete(ctx context.Context, namespace string) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM snapshots WHERE namespace = ?`, namespace)
+	if err != nil {
+		return fmt.Errorf("error deleting snapshots: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) History(ctx context.Context, namespace string, limit int) ([]Snapshot, error) {
+	rows, err := s.DB.QueryContext(ctx,
+		`SELECT created_at, items FROM snapshots WHERE namespace = ? ORDER BY id DESC LIMIT ?`, namespace, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying snapshot history: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []Snapshot
+	for rows.Next() {
+		var createdAt int64
+		var data string
+		err = rows.Scan(&createdAt, &data)
+		if err != nil {
+			return nil, fmt.Errorf("error reading snapshot row: %w", err)
+		}
+
+		snapshot := Snapshot{Time: time.Unix(0, createdAt).UTC()}
+		err = json.Unmarshal([]byte(data), &snapshot.Items)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshaling snapshot: %w", err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.DB.Close()
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"BugBountyGoApiWrapper/redismethods"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// ErrNoSnapshot is returned by Load when nothing was saved yet for a namespace
+var ErrNoSnapshot = errors.New("no previous snapshot found")
+
+// ErrConflict is returned by Update when another writer saved the namespace meanwhile
+var ErrConflict = errors.New("snapshot changed by another writer")
+
+// maxHistory is how many snapshots are kept per namespace
+const maxHistory = 100
+
+type Snapshot struct {
+	Time  time.Time `json:"time"`
+	Items []string  `json:"items"`
+}
+
+// SnapshotStore persists the latest set of items of a namespace along with its history
+type SnapshotStore interface {
+	// Load returns the items of the latest snapshot, or ErrNoSnapshot
+	Load(ctx context.Context, namespace string) ([]string, error)
+	// Save stores items as the latest snapshot and appends it to the history, unless they
+	// are the same as the latest snapshot
+	Save(ctx context.Context, namespace string, items []string) error
+	// Update passes what was added and removed in items since the latest snapshot to publish,
+	// and saves items only once publish returns nil, whose error is returned as is. It returns
+	// ErrConflict, without saving, when another writer saved the namespace in between, and
+	// ErrNoSnapshot, after saving without calling publish, when there was no snapshot.
+	Update(ctx context.Context, namespace string, items []string, publish func(added []string, removed []string) error) error
+	// SaveAndDiff saves items like Save and returns what was added and removed since the
+	// previous snapshot. It returns ErrNoSnapshot, after saving, when there was none.
+	SaveAndDiff(ctx context.Context, namespace string, items []string) (added []string, removed []string, err error)
+	// Delete removes the snapshot of a namespace along with its history
+	Delete(ctx context.Context, namespace string) error
+	// History returns up to limit snapshots, most recent first
+	History(ctx context.Context, namespace string, limit int) ([]Snapshot, error)
+	// Close releases the resources of the store
+	Close() error
+}
+
+// unchanged reports whether items hold the same set as the previous snapshot
+func unchanged(previous []string, items []string) bool {
+	added, removed := redismethods.CompareUniqueURLs(previous, items)
+	return len(added) == 0 && len(removed) == 0
+}
+
+// saveAndDiff implements SaveAndDiff on top of Update for every backend
+func saveAndDiff(ctx context.Context, store SnapshotStore, namespace string, items []string) ([]string, []string, error) {
+	var added, removed []string
+	err := store.Update(ctx, namespace, items, func(a []string, r []string) error {
+		added, removed = a, r
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return added, removed, nil
+}
+
+// Open returns the store for the given backend: redis, sqlite or file.
+// For sqlite and file, path is the database file or the snapshot directory
+// and rdb may be nil.
+func Open(backend string, path string, rdb *redis.Client) (SnapshotStore, error) {
+	switch backend {
+	case "", "redis":
+		return &RedisStore{Client: rdb}, nil
+	case "sqlite":
+		return NewSQLiteStore(path)
+	case "file":
+		return NewFileStore(path)
+	default:
+		return nil, fmt.Errorf("unknown snapshot backend: %s", backend)
+	}
+}
@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// testStores returns a fresh store of every backend, Redis only when REDIS_TEST_ADDR is set
+// since its database is flushed
+func testStores(t *testing.T) map[string]SnapshotStore {
+	t.Helper()
+
+	file, err := NewFileStore(filepath.Join(t.TempDir(), "snapshots"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	db, err := NewSQLiteStore(filepath.Join(t.TempDir(), "snapshots.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	stores := map[string]SnapshotStore{"file": file, "sqlite": db}
+	if addr := os.Getenv("REDIS_TEST_ADDR"); addr != "" {
+		rdb := redis.NewClient(&redis.Options{Addr: addr})
+		t.Cleanup(func() { rdb.Close() })
+		err = rdb.FlushDB(context.Background()).Err()
+		if err != nil {
+			t.Fatalf("FlushDB: %v", err)
+		}
+		stores["redis"] = &RedisStore{Client: rdb}
+	}
+	return stores
+}
+
+func sorted(items []string) []string {
+	items = append([]string(nil), items...)
+	sort.Strings(items)
+	return items
+}
+
+func TestLoadWithoutSnapshot(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := store.Load(context.Background(), "hackerone:previous_urls")
+			if err != ErrNoSnapshot {
+				t.Fatalf("Load() error = %v, want ErrNoSnapshot", err)
+			}
+		})
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, items := range [][]string{{"a.com", "b.com"}, {"c.com"}, {}} {
+				err := store.Save(ctx, "ns", items)
+				if err != nil {
+					t.Fatalf("Save(%v): %v", items, err)
+				}
+				got, err := store.Load(ctx, "ns")
+				if err != nil {
+					t.Fatalf("Load: %v", err)
+				}
+				if len(got) != len(items) || (len(items) > 0 && !reflect.DeepEqual(sorted(got), sorted(items))) {
+					t.Fatalf("Load() = %v, want %v", got, items)
+				}
+			}
+
+			// Namespaces are independent, even with separators in their names
+			_, err := store.Load(ctx, "ns:other")
+			if err != ErrNoSnapshot {
+				t.Fatalf("Load(other namespace) error = %v, want ErrNoSnapshot", err)
+			}
+		})
+	}
+}
+
+func TestSaveAndDiff(t *testing.T) {
+	tests := []struct {
+		items   []string
+		added   []string
+		removed []string
+		err     error
+	}{
+		{items: []string{"a.com", "b.com"}, err: ErrNoSnapshot},
+		{items: []string{"a.com", "b.com"}},
+		{items: []string{"b.com", "c.com"}, added: []string{"c.com"}, removed: []string{"a.com"}},
+		{items: []string{"b.com", "c.com", "d.com", "e.com"}, added: []string{"d.com", "e.com"}},
+		{items: []string{"e.com"}, removed: []string{"b.com", "c.com", "d.com"}},
+	}
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for i, tt := range tests {
+				added, removed, err := store.SaveAndDiff(ctx, "ns", tt.items)
+				if err != tt.err {
+					t.Fatalf("step %d: SaveAndDiff() error = %v, want %v", i, err, tt.err)
+				}
+				if !reflect.DeepEqual(sorted(added), sorted(tt.added)) {
+					t.Errorf("step %d: added = %v, want %v", i, added, tt.added)
+				}
+				if !reflect.DeepEqual(sorted(removed), sorted(tt.removed)) {
+					t.Errorf("step %d: removed = %v, want %v", i, removed, tt.removed)
+				}
+			}
+		})
+	}
+}
+
+func TestHistory(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for i := 0; i < maxHistory+5; i++ {
+				err := store.Save(ctx, "ns", []string{string(rune('a' + i%26))})
+				if err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			}
+
+			history, err := store.History(ctx, "ns", 3)
+			if err != nil {
+				t.Fatalf("History: %v", err)
+			}
+			if len(history) != 3 {
+				t.Fatalf("History(3) returned %d snapshots", len(history))
+			}
+			// Most recent first
+			last := maxHistory + 4
+			if history[0].Items[0] != string(rune('a'+last%26)) || history[1].Items[0] != string(rune('a'+(last-1)%26)) {
+				t.Errorf("History() = %v, want the latest snapshots first", history)
+			}
+			if history[0].Time.Before(history[1].Time) {
+				t.Errorf("History() times are not most recent first: %v, %v", history[0].Time, history[1].Time)
+			}
+
+			history, err = store.History(ctx, "ns", 2*maxHistory)
+			if err != nil {
+				t.Fatalf("History: %v", err)
+			}
+			if len(history) != maxHistory {
+				t.Errorf("History() kept %d snapshots, want %d", len(history), maxHistory)
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, items := range [][]string{{"a.com"}, {}} {
+				err := store.Save(ctx, "ns", items)
+				if err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			}
+			err := store.Delete(ctx, "ns")
+			if err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			_, err = store.Load(ctx, "ns")
+			if err != ErrNoSnapshot {
+				t.Errorf("Load() error = %v after Delete, want ErrNoSnapshot", err)
+			}
+			history, err := store.History(ctx, "ns", maxHistory)
+			if err != nil || len(history) != 0 {
+				t.Errorf("History() = %v, %v after Delete, want none", history, err)
+			}
+			// Deleting again is not an error
+			err = store.Delete(ctx, "ns")
+			if err != nil {
+				t.Errorf("Delete() of a missing namespace: %v", err)
+			}
+		})
+	}
+}
+
+func TestHistoryOnlyOnChange(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			err := store.Save(ctx, "ns", []string{"a.com", "b.com"})
+			if err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			// The same items in another order are not a change
+			err = store.Save(ctx, "ns", []string{"b.com", "a.com"})
+			if err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			_, _, err = store.SaveAndDiff(ctx, "ns", []string{"a.com", "b.com"})
+			if err != nil {
+				t.Fatalf("SaveAndDiff: %v", err)
+			}
+			published := false
+			err = store.Update(ctx, "ns", []string{"a.com", "b.com"}, func(added []string, removed []string) error {
+				published = true
+				return nil
+			})
+			if err != nil || !published {
+				t.Fatalf("Update() error = %v, published = %v, want publish called without changes", err, published)
+			}
+			err = store.Save(ctx, "ns", []string{"c.com"})
+			if err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			history, err := store.History(ctx, "ns", maxHistory)
+			if err != nil {
+				t.Fatalf("History: %v", err)
+			}
+			if len(history) != 2 || !reflect.DeepEqual(history[0].Items, []string{"c.com"}) {
+				t.Errorf("History() = %v, want the two different snapshots", history)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			published := 0
+			publish := func(added []string, removed []string) error {
+				published++
+				return nil
+			}
+
+			err := store.Update(ctx, "ns", []string{"a.com"}, publish)
+			if err != ErrNoSnapshot || published != 0 {
+				t.Fatalf("first Update() error = %v after %d publishes, want ErrNoSnapshot and none", err, published)
+			}
+
+			// A failed publish keeps the snapshot so the changes are reported again
+			failed := errors.New("stream unavailable")
+			err = store.Update(ctx, "ns", []string{"b.com"}, func(added []string, removed []string) error {
+				return failed
+			})
+			if err != failed {
+				t.Fatalf("Update() error = %v, want the publish error", err)
+			}
+			got, err := store.Load(ctx, "ns")
+			if err != nil || !reflect.DeepEqual(got, []string{"a.com"}) {
+				t.Fatalf("Load() = %v, %v after a failed publish, want [a.com]", got, err)
+			}
+
+			err = store.Update(ctx, "ns", []string{"b.com"}, func(added []string, removed []string) error {
+				if !reflect.DeepEqual(added, []string{"b.com"}) || !reflect.DeepEqual(removed, []string{"a.com"}) {
+					t.Errorf("publish(%v, %v), want [b.com] added and [a.com] removed", added, removed)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+
+			// An empty snapshot is still a snapshot
+			err = store.Update(ctx, "ns", []string{}, publish)
+			if err != nil || published != 1 {
+				t.Fatalf("Update(empty) error = %v after %d publishes", err, published)
+			}
+			got, err = store.Load(ctx, "ns")
+			if err != nil || len(got) != 0 {
+				t.Fatalf("Load() = %v, %v, want an empty snapshot", got, err)
+			}
+		})
+	}
+}
+
+func TestSQLiteUpdateConflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshots.db")
+	first, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer first.Close()
+	second, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer second.Close()
+
+	ctx := context.Background()
+	err = first.Save(ctx, "ns", []string{"a.com"})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// The second monitor saves while the first one is publishing
+	err = first.Update(ctx, "ns", []string{"b.com"}, func(added []string, removed []string) error {
+		return second.Save(ctx, "ns", []string{"c.com"})
+	})
+	if err != ErrConflict {
+		t.Fatalf("Update() error = %v, want ErrConflict", err)
+	}
+	got, err := first.Load(ctx, "ns")
+	if err != nil || !reflect.DeepEqual(got, []string{"c.com"}) {
+		t.Errorf("Load() = %v, %v, want the snapshot of the other writer", got, err)
+	}
+}
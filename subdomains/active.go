@@ -0,0 +1,183 @@
+package subdomains
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultWordlist is the wordlist used when none is configured
+//
+//go:embed wordlist.txt
+var defaultWordlist []byte
+
+// environments are the labels of the dev-, staging- style permutations
+var environments = []string{"dev", "staging", "stage", "test", "qa", "uat", "prod", "beta", "internal", "old", "new"}
+
+// LoadWordlist reads a wordlist, one label per line, the embedded one when path is empty
+func LoadWordlist(path string) ([]string, error) {
+	data := defaultWordlist
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading wordlist: %w", err)
+		}
+	}
+	var words []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word != "" && !strings.HasPrefix(word, "#") {
+			words = append(words, word)
+		}
+	}
+	return words, nil
+}
+
+// Bruteforce returns every word of the wordlist under every root
+func Bruteforce(roots, words []string) []string {
+	candidates := make([]string, 0, len(roots)*len(words))
+	for _, root := range roots {
+		for _, word := range words {
+			candidates = append(candidates, word+"."+root)
+		}
+	}
+	return candidates
+}
+
+// Permutations returns variants of the known subdomains of the roots: environment prefixes
+// and suffixes, numbered neighbours and dash/dot swaps of the first labels
+func Permutations(known, roots []string) []string {
+	var candidates []string
+	for _, host := range known {
+		root := rootOf(host, roots)
+		if root == "" || host == root {
+			continue
+		}
+		label, rest, _ := strings.Cut(host, ".")
+
+		for _, env := range environments {
+			candidates = append(candidates,
+				env+"-"+label+"."+rest,
+				label+"-"+env+"."+rest,
+				env+"."+host,
+			)
+		}
+
+		// api -> api1, api2; api2 -> api1, api3
+		trimmed := strings.TrimRight(label, "0123456789")
+		if n, err := strconv.Atoi(label[len(trimmed):]); err == nil {
+			for _, i := range []int{n - 1, n + 1, n + 2} {
+				if i >= 0 {
+					candidates = append(candidates, trimmed+strconv.Itoa(i)+"."+rest)
+				}
+			}
+		} else {
+			candidates = append(candidates, label+"1."+rest, label+"2."+rest, label+"-1."+rest, label+"-2."+rest)
+		}
+
+		// api-dev.example.com -> api.dev.example.com, api.dev.example.com -> api-dev.example.com
+		if strings.Contains(label, "-") {
+			candidates = append(candidates, strings.Replace(label, "-", ".", 1)+"."+rest)
+		}
+		if next, after, ok := strings.Cut(rest, "."); ok && IsSubdomainOf(after, root) {
+			candidates = append(candidates, label+"-"+next+"."+after)
+		}
+	}
+
+	var valid []string
+	for _, candidate := range candidates {
+		if rootOf(candidate, roots) != "" {
+			valid = append(valid, candidate)
+		}
+	}
+	return valid
+}
+
+// Candidates returns the bruteforce and permutation candidates of the roots that are not
+// already known, at most max of them. The budget is shared: candidates are taken in turn
+// from every root, alternating between its wordlist and its permutations, so neither a
+// large root nor a large wordlist starves the others.
+func Candidates(roots, words, known []string, max int) []string {
+	roots = sortedCopy(roots)
+	known = sortedCopy(known)
+	knownSet := make(map[string]bool, len(known))
+	for _, host := range known {
+		knownSet[host] = true
+	}
+
+	permutations := make(map[string][]string, len(roots))
+	for _, candidate := range Permutations(known, roots) {
+		root := rootOf(candidate, roots)
+		permutations[root] = append(permutations[root], candidate)
+	}
+	queues := make([][]string, 0, 2*len(roots))
+	for _, root := range roots {
+		queues = append(queues, Bruteforce([]string{root}, words), permutations[root])
+	}
+
+	seen := make(map[string]bool)
+	var candidates []string
+	full := func() bool { return max > 0 && len(candidates) >= max }
+	for len(queues) > 0 && !full() {
+		next := queues[:0]
+		for _, queue := range queues {
+			if full() {
+				break
+			}
+			for len(queue) > 0 {
+				candidate := Normalize(queue[0])
+				queue = queue[1:]
+				if !knownSet[candidate] && !seen[candidate] {
+					seen[candidate] = true
+					candidates = append(candidates, candidate)
+					break
+				}
+			}
+			if len(queue) > 0 {
+				next = append(next, queue)
+			}
+		}
+		queues = next
+	}
+	return candidates
+}
+
+// ResolveCandidates resolves the candidates and returns the ones with addresses of their own,
+// hosts answered by a wildcard are guesses that only look live
+func (r *Resolver) ResolveCandidates(ctx context.Context, candidates []string) map[string]Resolution {
+	resolutions := r.ResolveAll(ctx, candidates)
+	MarkWildcards(resolutions, r.DetectWildcards(ctx, resolutions))
+
+	hits := make(map[string]Resolution)
+	for host, resolution := range resolutions {
+		if resolution.Live() {
+			hits[host] = resolution
+		}
+	}
+	return hits
+}
+
+// rootOf returns the root the host belongs to, "" when none
+func rootOf(host string, roots []string) string {
+	for _, root := range roots {
+		if IsSubdomainOf(host, root) {
+			return root
+		}
+	}
+	return ""
+}
+
+// sortedCopy returns the items sorted, leaving the slice of the caller as is
+func sortedCopy(items []string) []string {
+	items = append([]string(nil), items...)
+	sort.Strings(items)
+	return items
+}
@@ -0,0 +1,63 @@
+package subdomains
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCandidatesShareBudget(t *testing.T) {
+	roots := []string{"b.com", "a.com"}
+	words := []string{"www", "api", "dev", "mail"}
+	known := []string{"shop.a.com", "www.b.com"}
+
+	candidates := Candidates(roots, words, known, 8)
+	if len(candidates) != 8 {
+		t.Fatalf("Candidates() returned %d, want 8", len(candidates))
+	}
+
+	perRoot := make(map[string]int)
+	bruteforce, permutations := 0, 0
+	for _, candidate := range candidates {
+		perRoot[rootOf(candidate, roots)]++
+		label, _, _ := strings.Cut(candidate, ".")
+		if contains(words, label) && strings.Count(candidate, ".") == 2 {
+			bruteforce++
+		} else {
+			permutations++
+		}
+		if contains(known, candidate) {
+			t.Errorf("known host %s returned as a candidate", candidate)
+		}
+	}
+	if perRoot["a.com"] != 4 || perRoot["b.com"] != 4 {
+		t.Errorf("candidates per root = %v, want 4 each", perRoot)
+	}
+	if bruteforce == 0 || permutations == 0 {
+		t.Errorf("%d bruteforce and %d permutation candidates, want both", bruteforce, permutations)
+	}
+
+	// Roots and known hosts come from map iteration, their order does not matter
+	again := Candidates([]string{"a.com", "b.com"}, words, []string{"www.b.com", "shop.a.com"}, 8)
+	if !reflect.DeepEqual(candidates, again) {
+		t.Errorf("Candidates() is not deterministic:\n%v\n%v", candidates, again)
+	}
+}
+
+func TestCandidatesUnlimited(t *testing.T) {
+	roots := []string{"a.com"}
+	words := []string{"www", "api"}
+	known := []string{"www.a.com"}
+
+	want := make(map[string]bool)
+	for _, candidate := range append(Bruteforce(roots, words), Permutations(known, roots)...) {
+		if !contains(known, candidate) {
+			want[candidate] = true
+		}
+	}
+
+	candidates := Candidates(roots, words, known, 0)
+	if len(candidates) != len(want) {
+		t.Errorf("Candidates() returned %d, want every one of the %d", len(candidates), len(want))
+	}
+}
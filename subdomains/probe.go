@@ -0,0 +1,278 @@
+package subdomains
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProbePorts are the scheme:port pairs tried on every host
+var DefaultProbePorts = []string{"https:443", "http:80", "https:8443", "http:8080"}
+
+// maxProbeBody is how much of a response body is read for the title, hash and fingerprints
+const maxProbeBody = 1 << 20
+
+// ProbeResult is what one scheme and port of a host answered
+type ProbeResult struct {
+	URL           string    `json:"url"`
+	FinalURL      string    `json:"final_url,omitempty"`
+	StatusCode    int       `json:"status_code"`
+	Title         string    `json:"title,omitempty"`
+	ContentLength int64     `json:"content_length"`
+	Server        string    `json:"server,omitempty"`
+	Tech          []string  `json:"tech,omitempty"`
+	TLSSubject    string    `json:"tls_subject,omitempty"`
+	TLSSANs       []string  `json:"tls_sans,omitempty"`
+	BodyHash      string    `json:"body_hash"`
+	Time          time.Time `json:"time"`
+}
+
+// Prober probes hosts over HTTP and HTTPS, like httpx
+type Prober struct {
+	Client  *http.Client
+	Ports   []string // scheme:port
+	Workers int
+}
+
+// NewProber returns a prober that follows at most maxRedirects redirects and does not
+// verify certificates, the certificate of misconfigured hosts is worth recording too
+func NewProber(ports []string, timeout time.Duration, maxRedirects, workers int) *Prober {
+	if len(ports) == 0 {
+		ports = DefaultProbePorts
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+			TLSHandshakeTimeout: timeout,
+			DisableKeepAlives:   true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+	return &Prober{Client: client, Ports: ports, Workers: workers}
+}
+
+// ProbeAll probes the hosts concurrently, hosts that answered on no port are missing
+func (p *Prober) ProbeAll(ctx context.Context, hosts []string) map[string][]ProbeResult {
+	results := make(map[string][]ProbeResult, len(hosts))
+	var mu sync.Mutex
+
+	workers := p.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				probes := p.Probe(ctx, host)
+				if len(probes) == 0 {
+					continue
+				}
+				mu.Lock()
+				results[host] = probes
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, host := range hosts {
+		jobs <- host
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// Probe tries every scheme and port on the host and returns the ones that answered
+func (p *Prober) Probe(ctx context.Context, host string) []ProbeResult {
+	var results []ProbeResult
+	for _, port := range p.Ports {
+		scheme, number, ok := strings.Cut(port, ":")
+		if !ok {
+			continue
+		}
+		target := scheme + "://" + host
+		if (scheme == "https" && number != "443") || (scheme == "http" && number != "80") {
+			target = scheme + "://" + net.JoinHostPort(host, number)
+		}
+		result, err := p.probeURL(ctx, target)
+		if err != nil {
+			continue
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (p *Prober) probeURL(ctx context.Context, target string) (ProbeResult, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return ProbeResult{}, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; SecurityScanner/1.0)")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return ProbeResult{}, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	if err != nil {
+		return ProbeResult{}, fmt.Errorf("error reading response body: %w", err)
+	}
+	sum := sha256.Sum256(body)
+
+	result := ProbeResult{
+		URL:           target,
+		StatusCode:    resp.StatusCode,
+		Title:         extractTitle(body),
+		ContentLength: resp.ContentLength,
+		Server:        resp.Header.Get("Server"),
+		Tech:          fingerprint(resp.Header, body),
+		BodyHash:      hex.EncodeToString(sum[:]),
+		Time:          time.Now().UTC(),
+	}
+	if result.ContentLength < 0 {
+		result.ContentLength = int64(len(body))
+	}
+	if final := resp.Request.URL.String(); final != target {
+		result.FinalURL = final
+	}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		certificate := resp.TLS.PeerCertificates[0]
+		result.TLSSubject = certificate.Subject.CommonName
+		result.TLSSANs = certificate.DNSNames
+	}
+	return result, nil
+}
+
+var (
+	titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	spacePattern = regexp.MustCompile(`\s+`)
+)
+
+// extractTitle returns the unescaped title of an HTML page, whitespace collapsed
+func extractTitle(body []byte) string {
+	match := titlePattern.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	title := strings.TrimSpace(spacePattern.ReplaceAllString(html.UnescapeString(string(match[1])), " "))
+	if len(title) > 200 {
+		title = title[:200]
+	}
+	return title
+}
+
+// techSignatures identify common technologies by a header value or a body substring
+var techSignatures = []struct {
+	name   string
+	header string // header whose value must contain value, body when empty
+	value  string
+}{
+	{"Nginx", "Server", "nginx"},
+	{"Apache", "Server", "Apache"},
+	{"IIS", "Server", "Microsoft-IIS"},
+	{"Cloudflare", "Server", "cloudflare"},
+	{"AmazonS3", "Server", "AmazonS3"},
+	{"CloudFront", "Via", "CloudFront"},
+	{"Varnish", "Via", "varnish"},
+	{"PHP", "X-Powered-By", "PHP"},
+	{"ASP.NET", "X-Powered-By", "ASP.NET"},
+	{"Express", "X-Powered-By", "Express"},
+	{"Next.js", "X-Powered-By", "Next.js"},
+	{"Next.js", "", "__NEXT_DATA__"},
+	{"WordPress", "", "/wp-content/"},
+	{"Drupal", "", "Drupal.settings"},
+	{"Jenkins", "X-Jenkins", ""},
+	{"Grafana", "", "grafana-app"},
+	{"Kibana", "kbn-name", ""},
+	{"Jira", "", "ajs-jira-base-url"},
+	{"GitLab", "", "gon.gitlab_url"},
+	{"React", "", "data-reactroot"},
+	{"Angular", "", "ng-version="},
+}
+
+// fingerprint returns the technologies whose signature matches the response, sorted
+func fingerprint(header http.Header, body []byte) []string {
+	found := make(map[string]bool)
+	for _, signature := range techSignatures {
+		var matched bool
+		switch {
+		case signature.header == "":
+			matched = strings.Contains(string(body), signature.value)
+		case signature.value == "":
+			matched = header.Get(signature.header) != ""
+		default:
+			matched = strings.Contains(strings.ToLower(header.Get(signature.header)), strings.ToLower(signature.value))
+		}
+		if matched {
+			found[signature.name] = true
+		}
+	}
+	var tech []string
+	for name := range found {
+		tech = append(tech, name)
+	}
+	sort.Strings(tech)
+	return tech
+}
+
+// DiffProbes describes how the endpoints of a host changed since the previous probe.
+// Body hash and length changes are left out, dynamic pages change them on every request.
+func DiffProbes(previous, current []ProbeResult) []string {
+	before := make(map[string]ProbeResult, len(previous))
+	for _, result := range previous {
+		before[result.URL] = result
+	}
+	after := make(map[string]ProbeResult, len(current))
+	for _, result := range current {
+		after[result.URL] = result
+	}
+
+	var changes []string
+	for _, result := range current {
+		old, ok := before[result.URL]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s started responding with %d", result.URL, result.StatusCode))
+			continue
+		}
+		if old.StatusCode != result.StatusCode {
+			changes = append(changes, fmt.Sprintf("%s started returning %d (was %d)", result.URL, result.StatusCode, old.StatusCode))
+		}
+		if old.Title != result.Title {
+			changes = append(changes, fmt.Sprintf("%s title changed from %s to %s", result.URL, strconv.Quote(old.Title), strconv.Quote(result.Title)))
+		}
+		if old.Server != result.Server {
+			changes = append(changes, fmt.Sprintf("%s server changed from %s to %s", result.URL, strconv.Quote(old.Server), strconv.Quote(result.Server)))
+		}
+	}
+	for _, result := range previous {
+		if _, ok := after[result.URL]; !ok {
+			changes = append(changes, fmt.Sprintf("%s stopped responding", result.URL))
+		}
+	}
+	return changes
+}
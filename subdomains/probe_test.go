@@ -0,0 +1,155 @@
+package subdomains
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbeURLRedirects(t *testing.T) {
+	// /hop/N redirects to /hop/N-1, /hop/0 is the landing page
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if n > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/hop/%d", n-1), http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "<html><head><title>Landing</title></head></html>")
+	}))
+	defer server.Close()
+
+	prober := NewProber(nil, time.Second, 2, 1)
+	tests := []struct {
+		hops   int
+		status int
+		final  string
+		title  string
+	}{
+		{hops: 0, status: http.StatusOK, final: "", title: "Landing"},
+		{hops: 2, status: http.StatusOK, final: "/hop/0", title: "Landing"},
+		// The third redirect is not followed, its response is the result
+		{hops: 5, status: http.StatusFound, final: "/hop/3"},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.hops), func(t *testing.T) {
+			target := fmt.Sprintf("%s/hop/%d", server.URL, tt.hops)
+			result, err := prober.probeURL(context.Background(), target)
+			if err != nil {
+				t.Fatalf("probeURL: %v", err)
+			}
+			if result.StatusCode != tt.status {
+				t.Errorf("StatusCode = %d, want %d", result.StatusCode, tt.status)
+			}
+			final := ""
+			if tt.final != "" {
+				final = server.URL + tt.final
+			}
+			if result.FinalURL != final {
+				t.Errorf("FinalURL = %q, want %q", result.FinalURL, final)
+			}
+			if result.Title != tt.title {
+				t.Errorf("Title = %q, want %q", result.Title, tt.title)
+			}
+		})
+	}
+}
+
+func TestExtractTitle(t *testing.T) {
+	tests := []struct {
+		body  string
+		title string
+	}{
+		{"<title>Home</title>", "Home"},
+		{"<HTML><TITLE lang=\"en\">\n  Sign   in\n</TITLE>", "Sign in"},
+		{"<title>Tom &amp; Jerry &#8211; Admin</title>", "Tom & Jerry – Admin"},
+		{"<title></title>", ""},
+		{"<h1>No title</h1>", ""},
+		{"<title>" + strings.Repeat("a", 300) + "</title>", strings.Repeat("a", 200)},
+	}
+	for _, tt := range tests {
+		if got := extractTitle([]byte(tt.body)); got != tt.title {
+			t.Errorf("extractTitle(%.40q) = %q, want %q", tt.body, got, tt.title)
+		}
+	}
+}
+
+func TestProbeURLTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.25")
+		fmt.Fprint(w, "<title>Secure</title>")
+	}))
+	defer server.Close()
+
+	// The test certificate is not trusted, the prober records it anyway
+	prober := NewProber(nil, time.Second, 2, 1)
+	result, err := prober.probeURL(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("probeURL: %v", err)
+	}
+	if !reflect.DeepEqual(result.TLSSANs, server.Certificate().DNSNames) || len(result.TLSSANs) == 0 {
+		t.Errorf("TLSSANs = %v, want %v", result.TLSSANs, server.Certificate().DNSNames)
+	}
+	if result.Title != "Secure" || result.Server != "nginx/1.25" {
+		t.Errorf("Title = %q, Server = %q", result.Title, result.Server)
+	}
+	if !reflect.DeepEqual(result.Tech, []string{"Nginx"}) {
+		t.Errorf("Tech = %v, want [Nginx]", result.Tech)
+	}
+}
+
+func TestDiffProbes(t *testing.T) {
+	home := ProbeResult{URL: "https://a.example.com", StatusCode: 200, Title: "Home", Server: "nginx", BodyHash: "1"}
+
+	tests := []struct {
+		name     string
+		previous []ProbeResult
+		current  []ProbeResult
+		changes  []string
+	}{
+		{
+			name:     "unchanged, body hash ignored",
+			previous: []ProbeResult{home},
+			current:  []ProbeResult{{URL: home.URL, StatusCode: 200, Title: "Home", Server: "nginx", BodyHash: "2"}},
+		},
+		{
+			name:     "started responding",
+			previous: []ProbeResult{},
+			current:  []ProbeResult{home},
+			changes:  []string{"https://a.example.com started responding with 200"},
+		},
+		{
+			name:     "stopped responding",
+			previous: []ProbeResult{home},
+			current:  nil,
+			changes:  []string{"https://a.example.com stopped responding"},
+		},
+		{
+			name:     "status, title and server",
+			previous: []ProbeResult{home},
+			current:  []ProbeResult{{URL: home.URL, StatusCode: 403, Title: "Forbidden", Server: "cloudflare"}},
+			changes: []string{
+				"https://a.example.com started returning 403 (was 200)",
+				`https://a.example.com title changed from "Home" to "Forbidden"`,
+				`https://a.example.com server changed from "nginx" to "cloudflare"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := DiffProbes(tt.previous, tt.current)
+			if !reflect.DeepEqual(changes, tt.changes) {
+				t.Errorf("DiffProbes() = %q, want %q", changes, tt.changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package subdomains
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/net/dns/dnsmessage"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Resolution statuses
+const (
+	StatusResolved = "resolved"
+	StatusNXDomain = "nxdomain"
+	StatusNoAnswer = "noanswer"
+	StatusError    = "error"
+)
+
+// Resolution is the result of resolving a host
+type Resolution struct {
+	Host     string    `json:"host"`
+	Status   string    `json:"status"`
+	A        []string  `json:"a,omitempty"`
+	AAAA     []string  `json:"aaaa,omitempty"`
+	CNAME    []string  `json:"cname,omitempty"`    // the chain, in order
+	Wildcard bool      `json:"wildcard,omitempty"` // answered by a wildcard of the parent domain
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Resolvable reports whether the host has an address
+func (r Resolution) Resolvable() bool {
+	return len(r.A) > 0 || len(r.AAAA) > 0
+}
+
+// Live reports whether the host has an address of its own, not one from a wildcard
+func (r Resolution) Live() bool {
+	return r.Resolvable() && !r.Wildcard
+}
+
+// Resolver resolves hosts against a list of DNS servers, rotating to the next one
+// when a query fails
+type Resolver struct {
+	Servers []string // host:port
+	Timeout time.Duration
+	Retries int
+	Workers int
+}
+
+// DefaultResolvers are used when no resolver is configured
+var DefaultResolvers = []string{"1.1.1.1", "8.8.8.8", "9.9.9.9"}
+
+// NewResolver returns a resolver for the servers, port 53 is assumed when a server has none
+func NewResolver(servers []string, timeout time.Duration, retries, workers int) *Resolver {
+	if len(servers) == 0 {
+		servers = DefaultResolvers
+	}
+	addresses := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		addresses = append(addresses, server)
+	}
+	return &Resolver{Servers: addresses, Timeout: timeout, Retries: retries, Workers: workers}
+}
+
+// errServerFailure is a SERVFAIL or REFUSED answer, worth retrying on another server
+var errServerFailure = errors.New("server failure")
+
+// ResolveAll resolves the hosts concurrently
+func (r *Resolver) ResolveAll(ctx context.Context, hosts []string) map[string]Resolution {
+	results := make(map[string]Resolution, len(hosts))
+	var mu sync.Mutex
+
+	workers := r.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				resolution := r.Resolve(ctx, host)
+				mu.Lock()
+				results[host] = resolution
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, host := range hosts {
+		jobs <- host
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// Resolve looks up the A and AAAA records of host, following CNAMEs. A failed lookup of
+// one type does not discard the answer of the other, its error is recorded.
+func (r *Resolver) Resolve(ctx context.Context, host string) Resolution {
+	resolution := Resolution{Host: host, Time: time.Now().UTC()}
+
+	nxdomain, failed := false, false
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		answers, rcode, err := r.exchange(ctx, host, qtype)
+		if err != nil {
+			failed = true
+			resolution.Error = err.Error()
+			continue
+		}
+		if rcode == dnsmessage.RCodeNameError {
+			nxdomain = true
+		}
+		var chain []string
+		for _, answer := range answers {
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				resolution.A = append(resolution.A, net.IP(body.A[:]).String())
+			case *dnsmessage.AAAAResource:
+				resolution.AAAA = append(resolution.AAAA, net.IP(body.AAAA[:]).String())
+			case *dnsmessage.CNAMEResource:
+				chain = append(chain, Normalize(body.CNAME.String()))
+			}
+		}
+		// Both answers carry the same chain, it is kept once
+		if len(resolution.CNAME) == 0 {
+			resolution.CNAME = chain
+		}
+	}
+
+	switch {
+	case resolution.Resolvable():
+		resolution.Status = StatusResolved
+	case nxdomain:
+		resolution.Status = StatusNXDomain
+	case failed:
+		resolution.Status = StatusError
+	default:
+		resolution.Status = StatusNoAnswer
+	}
+	return resolution
+}
+
+// exchange sends the query, retrying on the next server after a failure
+func (r *Resolver) exchange(ctx context.Context, host string, qtype dnsmessage.Type) ([]dnsmessage.Resource, dnsmessage.RCode, error) {
+	if len(r.Servers) == 0 {
+		return nil, 0, fmt.Errorf("no DNS servers configured")
+	}
+
+	var lastErr error
+	start := rand.Intn(len(r.Servers))
+	for attempt := 0; attempt <= r.Retries; attempt++ {
+		server := r.Servers[(start+attempt)%len(r.Servers)]
+		answers, rcode, err := r.query(ctx, server, host, qtype)
+		if err == nil {
+			return answers, rcode, nil
+		}
+		lastErr = fmt.Errorf("%s: %w", server, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, 0, lastErr
+}
+
+// query sends one query over UDP and reads the matching response
+func (r *Resolver) query(ctx context.Context, server, host string, qtype dnsmessage.Type) ([]dnsmessage.Resource, dnsmessage.RCode, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid host: %w", err)
+	}
+	id := uint16(rand.Intn(1 << 16))
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packet, err := msg.Pack()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error packing query: %w", err)
+	}
+
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	_, err = conn.Write(packet)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, 0, err
+		}
+		var response dnsmessage.Message
+		err = response.Unpack(buf[:n])
+		if err != nil || response.Header.ID != id || !response.Header.Response {
+			// Not an answer to our query, keep reading until the deadline
+			continue
+		}
+		switch response.Header.RCode {
+		case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+			return response.Answers, response.Header.RCode, nil
+		default:
+			return nil, response.Header.RCode, fmt.Errorf("%w: %s", errServerFailure, response.Header.RCode)
+		}
+	}
+}
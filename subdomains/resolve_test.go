@@ -0,0 +1,224 @@
+package subdomains
+
+import (
+	"context"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dnsZone is what the test DNS server knows, it answers like a recursive resolver
+type dnsZone struct {
+	cname    map[string]string
+	a        map[string]string
+	aaaa     map[string]string
+	nxdomain map[string]bool
+}
+
+// dnsServer is a UDP DNS server on localhost
+type dnsServer struct {
+	addr    string
+	zone    dnsZone
+	rcode   dnsmessage.RCode  // answered to every query when not success
+	drop    []dnsmessage.Type // query types never answered
+	queries atomic.Int32
+}
+
+func newDNSServer(t *testing.T, zone dnsZone, rcode dnsmessage.RCode, drop ...dnsmessage.Type) *dnsServer {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	s := &dnsServer{addr: conn.LocalAddr().String(), zone: zone, rcode: rcode, drop: drop}
+	go s.serve(conn)
+	return s
+}
+
+func (s *dnsServer) serve(conn net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var query dnsmessage.Message
+		if query.Unpack(buf[:n]) != nil || len(query.Questions) != 1 {
+			continue
+		}
+		s.queries.Add(1)
+		question := query.Questions[0]
+
+		dropped := false
+		for _, qtype := range s.drop {
+			dropped = dropped || qtype == question.Type
+		}
+		if dropped {
+			continue
+		}
+
+		response := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.Header.ID, Response: true, RCode: s.rcode},
+			Questions: query.Questions,
+		}
+		if s.rcode == dnsmessage.RCodeSuccess {
+			response.Header.RCode, response.Answers = s.zone.answer(question)
+		}
+		packet, err := response.Pack()
+		if err == nil {
+			conn.WriteTo(packet, addr)
+		}
+	}
+}
+
+// answer follows the CNAME chain of the question and returns the records of its end
+func (z dnsZone) answer(question dnsmessage.Question) (dnsmessage.RCode, []dnsmessage.Resource) {
+	var answers []dnsmessage.Resource
+	name := strings.TrimSuffix(question.Name.String(), ".")
+	header := func(owner string, qtype dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(owner + "."), Type: qtype, Class: dnsmessage.ClassINET, TTL: 60}
+	}
+
+	for target, ok := z.cname[name]; ok; target, ok = z.cname[name] {
+		answers = append(answers, dnsmessage.Resource{
+			Header: header(name, dnsmessage.TypeCNAME),
+			Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(target + ".")},
+		})
+		name = target
+	}
+	if z.nxdomain[name] {
+		return dnsmessage.RCodeNameError, answers
+	}
+
+	switch question.Type {
+	case dnsmessage.TypeA:
+		if ip, ok := z.a[name]; ok {
+			var a [4]byte
+			copy(a[:], net.ParseIP(ip).To4())
+			answers = append(answers, dnsmessage.Resource{Header: header(name, dnsmessage.TypeA), Body: &dnsmessage.AResource{A: a}})
+		}
+	case dnsmessage.TypeAAAA:
+		if ip, ok := z.aaaa[name]; ok {
+			var aaaa [16]byte
+			copy(aaaa[:], net.ParseIP(ip).To16())
+			answers = append(answers, dnsmessage.Resource{Header: header(name, dnsmessage.TypeAAAA), Body: &dnsmessage.AAAAResource{AAAA: aaaa}})
+		}
+	}
+	return dnsmessage.RCodeSuccess, answers
+}
+
+var testZone = dnsZone{
+	cname: map[string]string{
+		"www.example.com":      "edge.example.com",
+		"edge.example.com":     "example.cdn.net",
+		"dangling.example.com": "gone.cloudapp.net",
+	},
+	a: map[string]string{
+		"example.com":     "192.0.2.1",
+		"example.cdn.net": "192.0.2.2",
+		"v4.example.com":  "192.0.2.3",
+	},
+	aaaa: map[string]string{
+		"example.com":     "2001:db8::1",
+		"example.cdn.net": "2001:db8::2",
+	},
+	nxdomain: map[string]bool{
+		"missing.example.com": true,
+		"gone.cloudapp.net":   true,
+	},
+}
+
+func TestResolve(t *testing.T) {
+	server := newDNSServer(t, testZone, dnsmessage.RCodeSuccess)
+	resolver := &Resolver{Servers: []string{server.addr}, Timeout: time.Second}
+
+	tests := []struct {
+		host   string
+		status string
+		a      []string
+		aaaa   []string
+		cname  []string
+	}{
+		{host: "example.com", status: StatusResolved, a: []string{"192.0.2.1"}, aaaa: []string{"2001:db8::1"}},
+		{host: "v4.example.com", status: StatusResolved, a: []string{"192.0.2.3"}},
+		{host: "www.example.com", status: StatusResolved, a: []string{"192.0.2.2"}, aaaa: []string{"2001:db8::2"}, cname: []string{"edge.example.com", "example.cdn.net"}},
+		{host: "dangling.example.com", status: StatusNXDomain, cname: []string{"gone.cloudapp.net"}},
+		{host: "missing.example.com", status: StatusNXDomain},
+		{host: "empty.example.com", status: StatusNoAnswer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			got := resolver.Resolve(context.Background(), tt.host)
+			if got.Status != tt.status {
+				t.Errorf("Status = %q, want %q (error %q)", got.Status, tt.status, got.Error)
+			}
+			if !reflect.DeepEqual(got.A, tt.a) || !reflect.DeepEqual(got.AAAA, tt.aaaa) {
+				t.Errorf("A = %v, AAAA = %v, want %v and %v", got.A, got.AAAA, tt.a, tt.aaaa)
+			}
+			if !reflect.DeepEqual(got.CNAME, tt.cname) {
+				t.Errorf("CNAME = %v, want %v", got.CNAME, tt.cname)
+			}
+		})
+	}
+}
+
+func TestResolveServerFailure(t *testing.T) {
+	failing := newDNSServer(t, testZone, dnsmessage.RCodeServerFailure)
+	working := newDNSServer(t, testZone, dnsmessage.RCodeSuccess)
+
+	// Whichever server is tried first, a SERVFAIL moves on to the other one. The first
+	// server is random, resolve until the failing one was tried.
+	resolver := &Resolver{Servers: []string{failing.addr, working.addr}, Timeout: time.Second, Retries: 1}
+	for i := 0; i < 5 || (failing.queries.Load() == 0 && i < 50); i++ {
+		got := resolver.Resolve(context.Background(), "example.com")
+		if got.Status != StatusResolved || len(got.A) != 1 {
+			t.Fatalf("Resolve() = %+v, want the answer of the working server", got)
+		}
+	}
+	if failing.queries.Load() == 0 {
+		t.Errorf("the failing server was never queried")
+	}
+
+	// With no retries left the failure is reported
+	resolver = &Resolver{Servers: []string{failing.addr}, Timeout: time.Second, Retries: 1}
+	got := resolver.Resolve(context.Background(), "example.com")
+	if got.Status != StatusError || !strings.Contains(got.Error, "server failure") {
+		t.Errorf("Resolve() = %+v, want a server failure", got)
+	}
+}
+
+func TestResolveTimeout(t *testing.T) {
+	silent := newDNSServer(t, testZone, dnsmessage.RCodeSuccess, dnsmessage.TypeA, dnsmessage.TypeAAAA)
+
+	resolver := &Resolver{Servers: []string{silent.addr}, Timeout: 50 * time.Millisecond, Retries: 2}
+	got := resolver.Resolve(context.Background(), "example.com")
+	if got.Status != StatusError || got.Error == "" {
+		t.Errorf("Resolve() = %+v, want a timeout error", got)
+	}
+	// Every query type is tried once and retried twice
+	if n := silent.queries.Load(); n != 6 {
+		t.Errorf("%d queries sent, want 6", n)
+	}
+}
+
+func TestResolveKeepsAWhenAAAAFails(t *testing.T) {
+	server := newDNSServer(t, testZone, dnsmessage.RCodeSuccess, dnsmessage.TypeAAAA)
+
+	resolver := &Resolver{Servers: []string{server.addr}, Timeout: 50 * time.Millisecond}
+	got := resolver.Resolve(context.Background(), "www.example.com")
+	if got.Status != StatusResolved || !reflect.DeepEqual(got.A, []string{"192.0.2.2"}) {
+		t.Errorf("Resolve() = %+v, want the A answer kept", got)
+	}
+	if len(got.CNAME) != 2 {
+		t.Errorf("CNAME = %v, want the chain of the A answer", got.CNAME)
+	}
+	if got.Error == "" {
+		t.Errorf("the AAAA failure was not recorded")
+	}
+}
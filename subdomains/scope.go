@@ -0,0 +1,135 @@
+package subdomains
+
+import (
+	"golang.org/x/net/publicsuffix"
+	"regexp"
+	"strings"
+)
+
+// scopeEntry matches the hosts of one scope entry: a host, a URL or a wildcard
+type scopeEntry struct {
+	host    string
+	pattern *regexp.Regexp
+}
+
+// parseScopeEntry parses https://app.example.com/path, app.example.com,
+// *.api.example.com or api.*.example.com
+func parseScopeEntry(entry string) (scopeEntry, bool) {
+	host := Host(entry)
+	if host == "" {
+		return scopeEntry{}, false
+	}
+	if !strings.Contains(host, "*") {
+		return scopeEntry{host: host}, true
+	}
+
+	// A leading wildcard is any number of labels, one elsewhere is a single label
+	var expr string
+	rest := host
+	if strings.HasPrefix(rest, "*.") {
+		expr = `(?:[^.]+\.)+`
+		rest = rest[2:]
+	}
+	expr += strings.ReplaceAll(regexp.QuoteMeta(rest), `\*`, `[^.]*`)
+	pattern, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return scopeEntry{}, false
+	}
+	return scopeEntry{pattern: pattern}, true
+}
+
+func (e scopeEntry) matches(host string) bool {
+	if e.pattern != nil {
+		return e.pattern.MatchString(host)
+	}
+	return e.host == host
+}
+
+// Host returns the lowercase host of a scope entry, without scheme, port and path.
+// Wildcards are kept.
+func Host(entry string) string {
+	entry = strings.TrimSpace(entry)
+	if i := strings.Index(entry, "://"); i >= 0 {
+		entry = entry[i+3:]
+	}
+	entry = strings.SplitN(entry, "/", 2)[0]
+	entry = strings.SplitN(entry, ":", 2)[0]
+	return strings.ToLower(strings.TrimSuffix(entry, "."))
+}
+
+// EnumerationRoot returns the domain to enumerate for a scope entry: the host of a URL,
+// or what follows its last wildcard label. Public suffixes, like *.herokuapp.com, and
+// entries ending in a wildcard have none.
+func EnumerationRoot(entry string) string {
+	host := Host(entry)
+	if i := strings.LastIndex(host, "*."); i >= 0 {
+		host = host[i+2:]
+	}
+	if strings.Contains(host, "*") {
+		return ""
+	}
+	if _, err := publicsuffix.EffectiveTLDPlusOne(host); err != nil {
+		return ""
+	}
+	return host
+}
+
+// Scope is the scope of a program, the hosts its entries match minus the out of scope ones
+type Scope struct {
+	in  []scopeEntry
+	out []scopeEntry
+}
+
+func NewScope(inScope, outOfScope []string) *Scope {
+	scope := &Scope{}
+	for _, entry := range inScope {
+		if e, ok := parseScopeEntry(entry); ok {
+			scope.in = append(scope.in, e)
+		}
+	}
+	for _, entry := range outOfScope {
+		if e, ok := parseScopeEntry(entry); ok {
+			scope.out = append(scope.out, e)
+		}
+	}
+	return scope
+}
+
+// Contains reports whether the host is in scope
+func (s *Scope) Contains(host string) bool {
+	host = Normalize(host)
+	for _, e := range s.out {
+		if e.matches(host) {
+			return false
+		}
+	}
+	for _, e := range s.in {
+		if e.matches(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scopes are the scopes of several programs, keyed by program
+type Scopes map[string]*Scope
+
+// NewScopes builds the scope of every program from its in and out of scope entries
+func NewScopes(inScope, outOfScope map[string][]string) Scopes {
+	scopes := make(Scopes, len(inScope))
+	for program, entries := range inScope {
+		scopes[program] = NewScope(entries, outOfScope[program])
+	}
+	return scopes
+}
+
+// Programs returns the programs whose scope contains the host
+func (s Scopes) Programs(host string) []string {
+	var programs []string
+	for program, scope := range s {
+		if scope.Contains(host) {
+			programs = append(programs, program)
+		}
+	}
+	return programs
+}
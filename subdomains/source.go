@@ -0,0 +1,207 @@
+package subdomains
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SubdomainSource is a passive source of subdomains, like a certificate log or a DNS dataset
+type SubdomainSource interface {
+	// Name identifies the source in the attribution of the subdomains it found
+	Name() string
+	// Enumerate returns the subdomains of domain the source knows about
+	Enumerate(ctx context.Context, domain string) ([]string, error)
+}
+
+// DomainResult is what the sources returned for one domain
+type DomainResult struct {
+	// Subdomains maps every subdomain found to the sources that reported it
+	Subdomains map[string][]string
+	// Failed lists the sources whose query failed
+	Failed []string
+}
+
+// limiter spaces the requests of a source by interval
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newLimiter(interval time.Duration) *limiter {
+	return &limiter{interval: interval}
+}
+
+// Wait blocks until the next request is allowed
+func (l *limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	wait := l.next.Sub(now)
+	if wait < 0 {
+		wait = 0
+		l.next = now
+	}
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// Enumerate queries every source for every domain. Domains are worked on by workers
+// goroutines and the sources of a domain are queried concurrently, each source
+// keeping to its own rate limit.
+func Enumerate(ctx context.Context, sources []SubdomainSource, domains []string, workers int) map[string]*DomainResult {
+	if workers <= 0 {
+		workers = 1
+	}
+	results := make(map[string]*DomainResult, len(domains))
+	var mu sync.Mutex
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for domain := range jobs {
+				result := enumerateDomain(ctx, sources, domain)
+				mu.Lock()
+				results[domain] = result
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, domain := range domains {
+		jobs <- domain
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func enumerateDomain(ctx context.Context, sources []SubdomainSource, domain string) *DomainResult {
+	result := &DomainResult{Subdomains: make(map[string][]string)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source SubdomainSource) {
+			defer wg.Done()
+			found, err := source.Enumerate(ctx, domain)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("[%s] Failed to query %s: %v", source.Name(), domain, err)
+				result.Failed = append(result.Failed, source.Name())
+				return
+			}
+			count := 0
+			for _, name := range found {
+				name = Normalize(name)
+				if !IsSubdomainOf(name, domain) {
+					continue
+				}
+				if !contains(result.Subdomains[name], source.Name()) {
+					result.Subdomains[name] = append(result.Subdomains[name], source.Name())
+					count++
+				}
+			}
+			fmt.Printf("[%s] %s: %d subdomains\n", source.Name(), domain, count)
+		}(source)
+	}
+	wg.Wait()
+
+	for name := range result.Subdomains {
+		sort.Strings(result.Subdomains[name])
+	}
+	sort.Strings(result.Failed)
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize lowercases a name and strips wildcard labels and the trailing dot
+func Normalize(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.TrimPrefix(name, "*.")
+	return strings.TrimSuffix(name, ".")
+}
+
+// IsSubdomainOf reports whether name is domain or one of its subdomains
+func IsSubdomainOf(name, domain string) bool {
+	return name == domain || strings.HasSuffix(name, "."+domain)
+}
+
+// getJSON fetches url with the headers and decodes the JSON response into v
+func getJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, v interface{}) error {
+	body, err := get(ctx, client, url, headers)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// get fetches url with the headers and returns the body of a 200 response
+func get(ctx context.Context, client *http.Client, url string, headers map[string]string) ([]byte, error) {
+	body, err := getStream(ctx, client, url, headers)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	return data, nil
+}
+
+// getStream fetches url with the headers and returns the body of a 200 response to be read
+// as a stream, the caller closes it
+func getStream(ctx context.Context, client *http.Client, url string, headers map[string]string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; SecurityScanner/1.0)")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("API returned status: %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,374 @@
+package subdomains
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// httpSource holds what every HTTP source needs, the rate limit is per source
+type httpSource struct {
+	client  *http.Client
+	limiter *limiter
+	apiKey  string
+}
+
+func newHTTPSource(client *http.Client, interval time.Duration, apiKey string) httpSource {
+	return httpSource{client: client, limiter: newLimiter(interval), apiKey: apiKey}
+}
+
+// Anubis queries anubisdb.com
+type Anubis struct{ httpSource }
+
+func NewAnubis(client *http.Client) *Anubis {
+	return &Anubis{newHTTPSource(client, 500*time.Millisecond, "")}
+}
+
+func (s *Anubis) Name() string { return "anubis" }
+
+func (s *Anubis) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	err := s.limiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var subdomains []string
+	err = getJSON(ctx, s.client, "https://anubisdb.com/anubis/subdomains/"+domain, nil, &subdomains)
+	return subdomains, err
+}
+
+// CrtSh queries the crt.sh certificate transparency search
+type CrtSh struct{ httpSource }
+
+func NewCrtSh(client *http.Client) *CrtSh {
+	return &CrtSh{newHTTPSource(client, 2*time.Second, "")}
+}
+
+func (s *CrtSh) Name() string { return "crtsh" }
+
+func (s *CrtSh) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	err := s.limiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var certificates []struct {
+		NameValue string `json:"name_value"`
+	}
+	err = getJSON(ctx, s.client, "https://crt.sh/?output=json&q="+url.QueryEscape("%."+domain), nil, &certificates)
+	if err != nil {
+		return nil, err
+	}
+	var subdomains []string
+	for _, certificate := range certificates {
+		// One certificate lists all its names, one per line
+		subdomains = append(subdomains, strings.Split(certificate.NameValue, "\n")...)
+	}
+	return subdomains, nil
+}
+
+// CertSpotter queries the SSLMate CertSpotter issuances API, the key is optional
+type CertSpotter struct{ httpSource }
+
+func NewCertSpotter(client *http.Client, apiKey string) *CertSpotter {
+	return &CertSpotter{newHTTPSource(client, time.Second, apiKey)}
+}
+
+func (s *CertSpotter) Name() string { return "certspotter" }
+
+func (s *CertSpotter) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	headers := map[string]string{}
+	if s.apiKey != "" {
+		headers["Authorization"] = "Bearer " + s.apiKey
+	}
+
+	var subdomains []string
+	after := ""
+	// Results are paginated by issuance ID, a few pages cover most domains
+	for page := 0; page < 10; page++ {
+		err := s.limiter.Wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+		apiURL := fmt.Sprintf("https://api.certspotter.com/v1/issuances?domain=%s&include_subdomains=true&expand=dns_names", url.QueryEscape(domain))
+		if after != "" {
+			apiURL += "&after=" + url.QueryEscape(after)
+		}
+		var issuances []struct {
+			ID       string   `json:"id"`
+			DNSNames []string `json:"dns_names"`
+		}
+		err = getJSON(ctx, s.client, apiURL, headers, &issuances)
+		if err != nil {
+			return nil, err
+		}
+		if len(issuances) == 0 {
+			break
+		}
+		for _, issuance := range issuances {
+			subdomains = append(subdomains, issuance.DNSNames...)
+		}
+		after = issuances[len(issuances)-1].ID
+	}
+	return subdomains, nil
+}
+
+// AlienVault queries the passive DNS of AlienVault OTX, the key is optional
+type AlienVault struct{ httpSource }
+
+func NewAlienVault(client *http.Client, apiKey string) *AlienVault {
+	return &AlienVault{newHTTPSource(client, time.Second, apiKey)}
+}
+
+func (s *AlienVault) Name() string { return "alienvault" }
+
+func (s *AlienVault) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	err := s.limiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{}
+	if s.apiKey != "" {
+		headers["X-OTX-API-KEY"] = s.apiKey
+	}
+	var response struct {
+		PassiveDNS []struct {
+			Hostname string `json:"hostname"`
+		} `json:"passive_dns"`
+	}
+	err = getJSON(ctx, s.client, fmt.Sprintf("https://otx.alienvault.com/api/v1/indicators/domain/%s/passive_dns", domain), headers, &response)
+	if err != nil {
+		return nil, err
+	}
+	var subdomains []string
+	for _, record := range response.PassiveDNS {
+		subdomains = append(subdomains, record.Hostname)
+	}
+	return subdomains, nil
+}
+
+// Wayback extracts hosts from the URLs archived by the Wayback Machine
+type Wayback struct{ httpSource }
+
+func NewWayback(client *http.Client) *Wayback {
+	return &Wayback{newHTTPSource(client, time.Second, "")}
+}
+
+func (s *Wayback) Name() string { return "wayback" }
+
+func (s *Wayback) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	err := s.limiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	apiURL := fmt.Sprintf("https://web.archive.org/cdx/search/cdx?url=*.%s/*&output=txt&fl=original&collapse=urlkey", domain)
+	body, err := getStream(ctx, s.client, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return waybackHosts(io.LimitReader(body, maxWaybackBody))
+}
+
+// maxWaybackBody caps the archived URLs read per domain, they are sorted by host so a
+// domain with more only misses its last hosts
+const maxWaybackBody = 64 << 20
+
+// waybackHosts streams the archived URLs and returns their distinct hosts
+func waybackHosts(r io.Reader) ([]string, error) {
+	seen := make(map[string]bool)
+	var subdomains []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.Contains(line, "://") {
+			line = "http://" + line
+		}
+		u, err := url.Parse(line)
+		if err != nil || u.Hostname() == "" || seen[u.Hostname()] {
+			continue
+		}
+		seen[u.Hostname()] = true
+		subdomains = append(subdomains, u.Hostname())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	return subdomains, nil
+}
+
+// HackerTarget queries the HackerTarget host search, the key is optional
+type HackerTarget struct{ httpSource }
+
+func NewHackerTarget(client *http.Client, apiKey string) *HackerTarget {
+	return &HackerTarget{newHTTPSource(client, 2*time.Second, apiKey)}
+}
+
+func (s *HackerTarget) Name() string { return "hackertarget" }
+
+func (s *HackerTarget) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	err := s.limiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	apiURL := "https://api.hackertarget.com/hostsearch/?q=" + url.QueryEscape(domain)
+	if s.apiKey != "" {
+		apiURL += "&apikey=" + url.QueryEscape(s.apiKey)
+	}
+	body, err := get(ctx, s.client, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Errors come back as 200 with a plain message instead of host,ip lines
+	text := strings.TrimSpace(string(body))
+	if strings.HasPrefix(text, "error") || strings.HasPrefix(text, "API count exceeded") {
+		return nil, fmt.Errorf("hackertarget: %s", text)
+	}
+	var subdomains []string
+	for _, line := range strings.Split(text, "\n") {
+		host := strings.SplitN(line, ",", 2)[0]
+		if host != "" {
+			subdomains = append(subdomains, host)
+		}
+	}
+	return subdomains, nil
+}
+
+// VirusTotal queries the subdomains relationship of the VirusTotal v3 API
+type VirusTotal struct{ httpSource }
+
+func NewVirusTotal(client *http.Client, apiKey string) *VirusTotal {
+	// The public API allows 4 requests per minute
+	return &VirusTotal{newHTTPSource(client, 15*time.Second, apiKey)}
+}
+
+func (s *VirusTotal) Name() string { return "virustotal" }
+
+func (s *VirusTotal) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	headers := map[string]string{"x-apikey": s.apiKey}
+	next := fmt.Sprintf("https://www.virustotal.com/api/v3/domains/%s/subdomains?limit=40", domain)
+
+	var subdomains []string
+	for page := 0; page < 10 && next != ""; page++ {
+		err := s.limiter.Wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var response struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+			Links struct {
+				Next string `json:"next"`
+			} `json:"links"`
+		}
+		err = getJSON(ctx, s.client, next, headers, &response)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range response.Data {
+			subdomains = append(subdomains, item.ID)
+		}
+		next = response.Links.Next
+	}
+	return subdomains, nil
+}
+
+// SecurityTrails queries the SecurityTrails subdomains API
+type SecurityTrails struct{ httpSource }
+
+func NewSecurityTrails(client *http.Client, apiKey string) *SecurityTrails {
+	return &SecurityTrails{newHTTPSource(client, time.Second, apiKey)}
+}
+
+func (s *SecurityTrails) Name() string { return "securitytrails" }
+
+func (s *SecurityTrails) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	err := s.limiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Subdomains []string `json:"subdomains"`
+	}
+	err = getJSON(ctx, s.client, fmt.Sprintf("https://api.securitytrails.com/v1/domain/%s/subdomains", domain), map[string]string{"APIKEY": s.apiKey}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return withDomain(response.Subdomains, domain), nil
+}
+
+// Chaos queries the ProjectDiscovery Chaos dataset
+type Chaos struct{ httpSource }
+
+func NewChaos(client *http.Client, apiKey string) *Chaos {
+	return &Chaos{newHTTPSource(client, time.Second, apiKey)}
+}
+
+func (s *Chaos) Name() string { return "chaos" }
+
+func (s *Chaos) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	err := s.limiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Subdomains []string `json:"subdomains"`
+	}
+	err = getJSON(ctx, s.client, fmt.Sprintf("https://dns.projectdiscovery.io/dns/%s/subdomains", domain), map[string]string{"Authorization": s.apiKey}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return withDomain(response.Subdomains, domain), nil
+}
+
+// withDomain appends the domain to the labels returned by APIs that strip it
+func withDomain(labels []string, domain string) []string {
+	subdomains := make([]string, 0, len(labels))
+	for _, label := range labels {
+		if label == "" {
+			subdomains = append(subdomains, domain)
+		} else {
+			subdomains = append(subdomains, label+"."+domain)
+		}
+	}
+	return subdomains
+}
+
+// NewSources returns the sources named in names, all when it is empty. Sources that
+// need an API key are left out when keys has none for them.
+func NewSources(client *http.Client, names []string, keys map[string]string) []SubdomainSource {
+	all := []SubdomainSource{
+		NewAnubis(client),
+		NewCrtSh(client),
+		NewCertSpotter(client, keys["certspotter"]),
+		NewAlienVault(client, keys["alienvault"]),
+		NewWayback(client),
+		NewHackerTarget(client, keys["hackertarget"]),
+	}
+	if keys["virustotal"] != "" {
+		all = append(all, NewVirusTotal(client, keys["virustotal"]))
+	}
+	if keys["securitytrails"] != "" {
+		all = append(all, NewSecurityTrails(client, keys["securitytrails"]))
+	}
+	if keys["chaos"] != "" {
+		all = append(all, NewChaos(client, keys["chaos"]))
+	}
+
+	if len(names) == 0 {
+		return all
+	}
+	var selected []SubdomainSource
+	for _, source := range all {
+		if contains(names, source.Name()) {
+			selected = append(selected, source)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,38 @@
+package subdomains
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWaybackHosts(t *testing.T) {
+	archived := strings.Join([]string{
+		"https://a.example.com/login",
+		"http://a.example.com:8080/",
+		"b.example.com/path?q=1",
+		"",
+		"https://c.example.com/",
+	}, "\n")
+
+	hosts, err := waybackHosts(strings.NewReader(archived))
+	if err != nil {
+		t.Fatalf("waybackHosts: %v", err)
+	}
+	want := []string{"a.example.com", "b.example.com", "c.example.com"}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("waybackHosts() = %v, want %v", hosts, want)
+	}
+
+	// A capped body only loses the hosts past the cap
+	hosts, err = waybackHosts(io.LimitReader(strings.NewReader(archived), int64(strings.Index(archived, "b.example"))))
+	if err != nil || !reflect.DeepEqual(hosts, []string{"a.example.com"}) {
+		t.Errorf("waybackHosts(capped) = %v, %v, want [a.example.com]", hosts, err)
+	}
+
+	_, err = waybackHosts(strings.NewReader("https://a.example.com/" + strings.Repeat("x", 2<<20)))
+	if err == nil {
+		t.Errorf("waybackHosts() of an endless line succeeded")
+	}
+}
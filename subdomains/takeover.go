@@ -0,0 +1,175 @@
+package subdomains
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultFingerprints is the fingerprint file used when none is configured, kept in sync
+// with the services marked vulnerable by can-i-take-over-xyz
+//
+//go:embed fingerprints.json
+var defaultFingerprints []byte
+
+// Fingerprint identifies a service whose unclaimed resources can be taken over
+type Fingerprint struct {
+	Service string   `json:"service"`
+	CNAME   []string `json:"cname"`
+	// Fingerprint is a string of the body served for unclaimed resources
+	Fingerprint string `json:"fingerprint"`
+	// NXDomain means a CNAME to the service that does not resolve is enough
+	NXDomain bool `json:"nxdomain"`
+}
+
+// TakeoverCandidate is a subdomain that looks like it can be taken over, with the evidence
+type TakeoverCandidate struct {
+	Host     string    `json:"host"`
+	Service  string    `json:"service"`
+	CNAME    []string  `json:"cname"`
+	Evidence string    `json:"evidence"`
+	Time     time.Time `json:"time"`
+}
+
+// LoadFingerprints reads a fingerprint file, the embedded one when path is empty
+func LoadFingerprints(path string) ([]Fingerprint, error) {
+	data := defaultFingerprints
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading fingerprints: %w", err)
+		}
+	}
+	var fingerprints []Fingerprint
+	err := json.Unmarshal(data, &fingerprints)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding fingerprints: %w", err)
+	}
+	return fingerprints, nil
+}
+
+// TakeoverChecker flags dangling CNAMEs to the services of its fingerprints
+type TakeoverChecker struct {
+	Client       *http.Client
+	Fingerprints []Fingerprint
+	Workers      int
+}
+
+// CheckAll checks the resolutions concurrently and returns the candidates, keyed by host
+func (c *TakeoverChecker) CheckAll(ctx context.Context, resolutions map[string]Resolution) map[string]TakeoverCandidate {
+	candidates := make(map[string]TakeoverCandidate)
+	var mu sync.Mutex
+
+	workers := c.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				candidate, ok := c.Check(ctx, resolutions[host])
+				if !ok {
+					continue
+				}
+				mu.Lock()
+				candidates[host] = candidate
+				mu.Unlock()
+			}
+		}()
+	}
+	for host := range resolutions {
+		jobs <- host
+	}
+	close(jobs)
+	wg.Wait()
+
+	return candidates
+}
+
+// Check matches the CNAME chain of the host against the fingerprints, then confirms the
+// match with a resolution failure or the body of the service
+func (c *TakeoverChecker) Check(ctx context.Context, resolution Resolution) (TakeoverCandidate, bool) {
+	if len(resolution.CNAME) == 0 || resolution.Wildcard || resolution.Status == StatusError {
+		return TakeoverCandidate{}, false
+	}
+	fingerprint, target, ok := c.match(resolution.CNAME)
+	if !ok {
+		return TakeoverCandidate{}, false
+	}
+
+	candidate := TakeoverCandidate{
+		Host:    resolution.Host,
+		Service: fingerprint.Service,
+		CNAME:   resolution.CNAME,
+		Time:    time.Now().UTC(),
+	}
+	if !resolution.Resolvable() {
+		if !fingerprint.NXDomain {
+			return TakeoverCandidate{}, false
+		}
+		candidate.Evidence = fmt.Sprintf("CNAME %s does not resolve (%s)", target, resolution.Status)
+		return candidate, true
+	}
+	if fingerprint.Fingerprint == "" {
+		return TakeoverCandidate{}, false
+	}
+
+	for _, scheme := range []string{"https", "http"} {
+		status, body, err := c.fetch(ctx, scheme+"://"+resolution.Host)
+		if err != nil {
+			continue
+		}
+		if strings.Contains(body, fingerprint.Fingerprint) {
+			candidate.Evidence = fmt.Sprintf("CNAME %s, %s://%s returned %d with %q", target, scheme, resolution.Host, status, fingerprint.Fingerprint)
+			return candidate, true
+		}
+	}
+	return TakeoverCandidate{}, false
+}
+
+// match returns the first fingerprint one of the CNAMEs points to, and that CNAME
+func (c *TakeoverChecker) match(chain []string) (Fingerprint, string, bool) {
+	for _, target := range chain {
+		for _, fingerprint := range c.Fingerprints {
+			for _, pattern := range fingerprint.CNAME {
+				if strings.Contains(target, pattern) {
+					return fingerprint, target, true
+				}
+			}
+		}
+	}
+	return Fingerprint{}, "", false
+}
+
+// fetch returns the status and body of a URL, whatever the status
+func (c *TakeoverChecker) fetch(ctx context.Context, url string) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; SecurityScanner/1.0)")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	if err != nil {
+		return 0, "", fmt.Errorf("error reading response body: %w", err)
+	}
+	return resp.StatusCode, string(body), nil
+}
@@ -0,0 +1,96 @@
+package subdomains
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadFingerprints(t *testing.T) {
+	fingerprints, err := LoadFingerprints("")
+	if err != nil {
+		t.Fatalf("LoadFingerprints(embedded): %v", err)
+	}
+	if len(fingerprints) == 0 {
+		t.Fatalf("the embedded fingerprints are empty")
+	}
+	for _, fingerprint := range fingerprints {
+		// A fingerprint that can't be confirmed would flag every CNAME to the service
+		if fingerprint.Service == "" || len(fingerprint.CNAME) == 0 || (fingerprint.Fingerprint == "" && !fingerprint.NXDomain) {
+			t.Errorf("incomplete fingerprint %+v", fingerprint)
+		}
+	}
+
+	dir := t.TempDir()
+	custom := filepath.Join(dir, "custom.json")
+	err = os.WriteFile(custom, []byte(`[{"service": "Custom", "cname": ["custom.net"], "nxdomain": true}]`), 0o644)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	fingerprints, err = LoadFingerprints(custom)
+	if err != nil || len(fingerprints) != 1 || fingerprints[0].Service != "Custom" || !fingerprints[0].NXDomain {
+		t.Errorf("LoadFingerprints(custom) = %+v, %v", fingerprints, err)
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	err = os.WriteFile(invalid, []byte(`{"service": "not a list"}`), 0o644)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err = LoadFingerprints(invalid); err == nil {
+		t.Errorf("LoadFingerprints(invalid) succeeded")
+	}
+	if _, err = LoadFingerprints(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("LoadFingerprints(missing) succeeded")
+	}
+}
+
+func TestCheckAll(t *testing.T) {
+	unclaimed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<h1>404</h1><p>There isn't a GitHub Pages site here.</p>")
+	}))
+	defer unclaimed.Close()
+	claimed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<title>Docs</title>")
+	}))
+	defer claimed.Close()
+
+	fingerprints, err := LoadFingerprints("")
+	if err != nil {
+		t.Fatalf("LoadFingerprints: %v", err)
+	}
+	checker := &TakeoverChecker{Client: &http.Client{Timeout: time.Second}, Fingerprints: fingerprints, Workers: 3}
+
+	// The hosts are the test servers, the https attempt fails and http is tried next. The
+	// candidates are keyed like the resolutions, names are enough here.
+	unclaimedHost := strings.TrimPrefix(unclaimed.URL, "http://")
+	claimedHost := strings.TrimPrefix(claimed.URL, "http://")
+	resolutions := map[string]Resolution{
+		"pages":    {Host: unclaimedHost, Status: StatusResolved, A: []string{"127.0.0.1"}, CNAME: []string{"acme.github.io"}},
+		"claimed":  {Host: claimedHost, Status: StatusResolved, A: []string{"127.0.0.1"}, CNAME: []string{"docs.github.io"}},
+		"other":    {Host: unclaimedHost, Status: StatusResolved, A: []string{"127.0.0.1"}, CNAME: []string{"edge.example.net"}},
+		"azure":    {Host: "gone.acme.com", Status: StatusNXDomain, CNAME: []string{"acme.cloudapp.net"}},
+		"dangling": {Host: "old.acme.com", Status: StatusNXDomain, CNAME: []string{"old.github.io"}},
+		"wildcard": {Host: unclaimedHost, Status: StatusResolved, A: []string{"127.0.0.1"}, CNAME: []string{"x.github.io"}, Wildcard: true},
+		"direct":   {Host: unclaimedHost, Status: StatusResolved, A: []string{"127.0.0.1"}},
+	}
+	var found []string
+	for name, candidate := range checker.CheckAll(context.Background(), resolutions) {
+		found = append(found, name)
+		if candidate.Host != resolutions[name].Host || candidate.Service == "" || candidate.Evidence == "" {
+			t.Errorf("candidate %s = %+v, want its host, service and evidence", name, candidate)
+		}
+	}
+	sort.Strings(found)
+	if strings.Join(found, ",") != "azure,pages" {
+		t.Errorf("CheckAll() flagged %v, want azure and pages", found)
+	}
+}
@@ -0,0 +1,114 @@
+package subdomains
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"golang.org/x/net/publicsuffix"
+	"strings"
+)
+
+// wildcardProbes is how many random labels are resolved under each parent domain.
+// Wildcards behind load balancers answer with varying addresses, more probes see more of them.
+const wildcardProbes = 3
+
+// Wildcard is a zone answering for any label, with the answers seen for random labels
+type Wildcard struct {
+	Domain  string
+	Answers map[string]bool // addresses, and CNAME targets prefixed with cname:
+}
+
+// Matches reports whether the resolution is explained by the wildcard: all its addresses,
+// or its CNAME target, were also returned for random labels
+func (w *Wildcard) Matches(resolution Resolution) bool {
+	if len(resolution.CNAME) > 0 && w.Answers["cname:"+resolution.CNAME[0]] {
+		return true
+	}
+	if !resolution.Resolvable() {
+		return false
+	}
+	for _, address := range append(resolution.A, resolution.AAAA...) {
+		if !w.Answers[address] {
+			return false
+		}
+	}
+	return true
+}
+
+// DetectWildcards probes the parent domain of every resolvable host with random labels
+// and returns the wildcard zones found, keyed by domain
+func (r *Resolver) DetectWildcards(ctx context.Context, resolutions map[string]Resolution) map[string]*Wildcard {
+	parents := make(map[string]bool)
+	for host, resolution := range resolutions {
+		if !resolution.Resolvable() && len(resolution.CNAME) == 0 {
+			continue
+		}
+		if parent := parentDomain(host); parent != "" {
+			parents[parent] = true
+		}
+	}
+
+	probes := make([]string, 0, len(parents)*wildcardProbes)
+	probeParent := make(map[string]string, cap(probes))
+	for parent := range parents {
+		for i := 0; i < wildcardProbes; i++ {
+			probe := randomLabel() + "." + parent
+			probes = append(probes, probe)
+			probeParent[probe] = parent
+		}
+	}
+
+	wildcards := make(map[string]*Wildcard)
+	for probe, resolution := range r.ResolveAll(ctx, probes) {
+		if !resolution.Resolvable() && len(resolution.CNAME) == 0 {
+			continue
+		}
+		parent := probeParent[probe]
+		wildcard, ok := wildcards[parent]
+		if !ok {
+			wildcard = &Wildcard{Domain: parent, Answers: make(map[string]bool)}
+			wildcards[parent] = wildcard
+		}
+		for _, address := range append(resolution.A, resolution.AAAA...) {
+			wildcard.Answers[address] = true
+		}
+		if len(resolution.CNAME) > 0 {
+			wildcard.Answers["cname:"+resolution.CNAME[0]] = true
+		}
+	}
+	return wildcards
+}
+
+// MarkWildcards sets Wildcard on the resolutions answered by the wildcard of their parent domain
+func MarkWildcards(resolutions map[string]Resolution, wildcards map[string]*Wildcard) int {
+	marked := 0
+	for host, resolution := range resolutions {
+		wildcard, ok := wildcards[parentDomain(host)]
+		if ok && wildcard.Matches(resolution) {
+			resolution.Wildcard = true
+			resolutions[host] = resolution
+			marked++
+		}
+	}
+	return marked
+}
+
+// parentDomain returns host without its first label, or "" when that is a public suffix
+func parentDomain(host string) string {
+	i := strings.Index(host, ".")
+	if i < 0 {
+		return ""
+	}
+	parent := host[i+1:]
+	if _, err := publicsuffix.EffectiveTLDPlusOne(parent); err != nil {
+		return ""
+	}
+	return parent
+}
+
+// randomLabel returns a label unlikely to exist in any zone
+func randomLabel() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "wc-" + hex.EncodeToString(b)
+}
@@ -1,50 +1,69 @@
 package main
 
 import (
+	"BugBountyGoApiWrapper/env"
+	"BugBountyGoApiWrapper/events"
+	"BugBountyGoApiWrapper/redismethods"
+	"BugBountyGoApiWrapper/storage"
+	"BugBountyGoApiWrapper/subdomains"
 	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/redis/go-redis/v9"
-	"golang.org/x/net/publicsuffix"
 	"log"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 )
 
 func main() {
+	// Connect to Redis
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	// Test Redis connection
+	_, err := rdb.Ping(ctx).Result()
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+	fmt.Println("Connected to Redis!")
+
+	// The store is opened once, a SQLite store holds a database handle
+	store, err := storage.Open(env.Env["SNAPSHOT_BACKEND"], env.Env["SNAPSHOT_PATH"], rdb)
+	if err != nil {
+		log.Fatalf("Failed to open snapshot store: %v", err)
+	}
+	defer store.Close()
+
 	for {
-		// Connect to Redis
-		ctx := context.Background()
-		rdb := redis.NewClient(&redis.Options{
-			Addr: "localhost:6379",
-		})
+		// A run interrupted by a crash is run again under the same ID
+		runID := redismethods.BeginRun(ctx, rdb, "subfinder")
 
-		// Test Redis connection
-		_, err := rdb.Ping(ctx).Result()
+		// Get URLs saved by the HackerOne monitor
+		urls, err := store.Load(ctx, "hackerone:previous_urls")
 		if err != nil {
-			log.Fatalf("Failed to connect to Redis: %v", err)
+			log.Fatalf("Failed to get URLs from snapshot store: %v", err)
 		}
-		fmt.Println("Connected to Redis!")
 
-		// Get URLs from Redis
-		urlsData, err := rdb.Get(ctx, "hackerone:previous_urls").Result()
+		// Subdomains are checked against the scope of every program, out of scope entries included
+		groups, err := redismethods.GroupByProgram(ctx, rdb, "hackerone", urls)
 		if err != nil {
-			log.Fatalf("Failed to get URLs from Redis: %v", err)
+			log.Printf("Error grouping URLs by program: %v", err)
+			groups = map[string][]string{"": urls}
 		}
-
-		// Parse the URLs data as JSON array
-		var urls []string
-		err = json.Unmarshal([]byte(urlsData), &urls)
+		outOfScope, err := redismethods.GetOutOfScope(ctx, rdb, "hackerone")
 		if err != nil {
-			log.Fatalf("Failed to unmarshal URLs from Redis: %v", err)
+			log.Printf("Error getting out of scope entries: %v", err)
 		}
-		// Extract unique domains from URLs
+		scopes := subdomains.NewScopes(groups, outOfScope)
+
+		// Enumerate under each scope entry, not the whole registered domain
 		domainMap := make(map[string]bool)
 		for _, urlStr := range urls {
-			domain := extractDomain(urlStr)
-			//fmt.Printf("Extracted domain: %s\n", domain)
-			//fmt.Printf("Extracted urlstr: %s\n", urlStr)
+			domain := subdomains.EnumerationRoot(urlStr)
 			if domain != "" {
 				domainMap[domain] = true
 			}
@@ -57,145 +76,432 @@ func main() {
 
 		fmt.Printf("Found %d unique domains from Redis\n", len(domains))
 
-		// Query Anubis for each domain with rate limiting
+		// Query every passive source for each domain, each source has its own rate limit
 		client := &http.Client{Timeout: 30 * time.Second}
+		sources := subdomains.NewSources(client, splitList(env.Env["SUBDOMAIN_SOURCES"]), map[string]string{
+			"certspotter":    env.Env["CERTSPOTTER_API_KEY"],
+			"alienvault":     env.Env["OTX_API_KEY"],
+			"hackertarget":   env.Env["HACKERTARGET_API_KEY"],
+			"virustotal":     env.Env["VIRUSTOTAL_API_KEY"],
+			"securitytrails": env.Env["SECURITYTRAILS_API_KEY"],
+			"chaos":          env.Env["CHAOS_API_KEY"],
+		})
+		var names []string
+		for _, source := range sources {
+			names = append(names, source.Name())
+		}
+		fmt.Printf("Querying %d sources: %s\n", len(sources), strings.Join(names, ", "))
 
-		// Rate limiting: 1 request every 500ms (2 requests per second)
-		ticker := time.NewTicker(500 * time.Millisecond)
-		defer ticker.Stop()
+		results := subdomains.Enumerate(ctx, sources, domains, env.GetInt("SUBFINDER_WORKERS", 5))
 
-		// Collect all subdomains in a flat list
+		// Collect all subdomains in a flat list, with the sources that found them
 		allSubdomains := make(map[string]bool)
+		attribution := make(map[string][]string)
 
-		for i, domain := range domains {
-			<-ticker.C // Wait for the next tick
-
-			fmt.Printf("[%d/%d] Querying Anubis for: %s\n", i+1, len(domains), domain)
-
-			subdomains, err := queryAnubis(client, domain)
-			if err != nil {
-				log.Printf("Failed to query Anubis for %s: %v", domain, err)
-				continue
-			}
-
-			fmt.Printf("Found %d subdomains for %s\n", len(subdomains), domain)
+		for domain, result := range results {
+			fmt.Printf("Found %d subdomains for %s\n", len(result.Subdomains), domain)
 
 			// Add the main domain itself
 			allSubdomains[domain] = true
 
 			// Add all subdomains
-			for _, subdomain := range subdomains {
+			for subdomain, names := range result.Subdomains {
 				allSubdomains[subdomain] = true
+				attribution[subdomain] = names
 			}
 		}
 
-		// Convert map to slice
+		resolver := subdomains.NewResolver(
+			splitList(env.Env["DNS_RESOLVERS"]),
+			time.Duration(env.GetInt("DNS_TIMEOUT_SECONDS", 3))*time.Second,
+			env.GetInt("DNS_RETRIES", 2),
+			env.GetInt("DNS_WORKERS", 50),
+		)
+
+		// Active enumeration only runs for the programs that opted in, some programs prohibit it
+		activeHits := 0
+		activePrograms, err := redismethods.GetActivePrograms(ctx, rdb)
+		if err != nil {
+			log.Printf("Error getting active programs: %v", err)
+		}
+		if len(activePrograms) > 0 {
+			activeHits = enumerateActive(ctx, resolver, scopes, groups, activePrograms, allSubdomains, attribution)
+		}
+
+		err = redismethods.SaveSubdomainSources(ctx, rdb, attribution)
+		if err != nil {
+			log.Printf("Error saving subdomain sources: %v", err)
+		}
+
+		// Only in scope subdomains are reported, the others are kept as related
 		currentSubdomains := make([]string, 0, len(allSubdomains))
+		var related []string
 		for subdomain := range allSubdomains {
-			currentSubdomains = append(currentSubdomains, subdomain)
+			if len(scopes.Programs(subdomain)) > 0 {
+				currentSubdomains = append(currentSubdomains, subdomain)
+			} else {
+				related = append(related, subdomain)
+			}
+		}
+
+		fmt.Printf("\nTotal unique subdomains found: %d in scope, %d related out of scope\n", len(currentSubdomains), len(related))
+
+		err = store.Save(ctx, "subfinder:related_subdomains", related)
+		if err != nil {
+			log.Printf("Error saving related subdomains: %v", err)
+		}
+
+		// Resolve the in scope subdomains, notifications are about the ones that resolve
+		previousResolutions, err := redismethods.GetResolutions(ctx, rdb, currentSubdomains)
+		if err != nil {
+			log.Printf("Error getting previous resolutions: %v", err)
+		}
+		resolutions := resolver.ResolveAll(ctx, currentSubdomains)
+
+		// Hosts only answered by the wildcard of their parent domain are not real subdomains,
+		// they are dropped, or kept but never notified with DNS_WILDCARD_MODE=flag
+		wildcards := resolver.DetectWildcards(ctx, resolutions)
+		wildcarded := subdomains.MarkWildcards(resolutions, wildcards)
+		fmt.Printf("Found %d wildcard domains answering for %d subdomains\n", len(wildcards), wildcarded)
+		// Dropped hosts are neither added nor removed, a known one stays in its snapshot
+		wildcardDropped := make(map[string]bool)
+		if env.Env["DNS_WILDCARD_MODE"] != "flag" {
+			for host, resolution := range resolutions {
+				if resolution.Wildcard {
+					wildcardDropped[host] = true
+					delete(resolutions, host)
+				}
+			}
+		}
+
+		// Failed lookups say nothing about the host, the previous resolution is kept
+		resolved := make(map[string]subdomains.Resolution, len(resolutions))
+		var live []string
+		for host, resolution := range resolutions {
+			if resolution.Status == subdomains.StatusError {
+				continue
+			}
+			resolved[host] = resolution
+			previous, ok := previousResolutions[host]
+			if ok && !previous.Live() && resolution.Live() {
+				live = append(live, host)
+			}
+		}
+		err = redismethods.SaveResolutions(ctx, rdb, resolved)
+		if err != nil {
+			log.Printf("Error saving resolutions: %v", err)
 		}
 
-		fmt.Printf("\nTotal unique subdomains found: %d\n", len(currentSubdomains))
+		resolving := 0
+		for _, resolution := range resolved {
+			if resolution.Live() {
+				resolving++
+			}
+		}
+		fmt.Printf("Resolved %d subdomains: %d resolving, %d failed lookups\n", len(resolutions), resolving, len(resolutions)-len(resolved))
 
 		// Compare with previous run
-		compareAndSave(ctx, rdb, currentSubdomains)
+		added, removed := compareAndSave(ctx, rdb, store, domains, results, scopes, currentSubdomains, wildcardDropped, resolved, live, runID)
+
+		// Probe the hosts that resolve over HTTP, changes on known hosts are notified
+		var liveHosts []string
+		for host, resolution := range resolved {
+			if resolution.Live() {
+				liveHosts = append(liveHosts, host)
+			}
+		}
+		prober := subdomains.NewProber(
+			splitList(env.Env["HTTP_PROBE_PORTS"]),
+			time.Duration(env.GetInt("HTTP_PROBE_TIMEOUT_SECONDS", 10))*time.Second,
+			env.GetInt("HTTP_PROBE_MAX_REDIRECTS", 3),
+			env.GetInt("HTTP_PROBE_WORKERS", 20),
+		)
+		responding, changed := probeHosts(ctx, rdb, prober, scopes, liveHosts, runID)
+
+		// Dangling CNAMEs to services that let anyone claim the name are high priority
+		takeovers := 0
+		fingerprints, err := subdomains.LoadFingerprints(env.Env["TAKEOVER_FINGERPRINTS"])
+		if err != nil {
+			log.Printf("Error loading takeover fingerprints: %v", err)
+		} else {
+			checker := &subdomains.TakeoverChecker{Client: prober.Client, Fingerprints: fingerprints, Workers: prober.Workers}
+			takeovers = checkTakeovers(ctx, rdb, checker, scopes, resolved, runID)
+		}
+
+		err = redismethods.RecordRunStatus(ctx, rdb, "subfinder", map[string]int{
+			"domains":      len(domains),
+			"subdomains":   len(currentSubdomains),
+			"related":      len(related),
+			"active":       activeHits,
+			"resolving":    resolving,
+			"wildcard":     wildcarded,
+			"live":         len(live),
+			"responding":   responding,
+			"http_changed": changed,
+			"takeovers":    takeovers,
+			"added":        added,
+			"removed":      removed,
+		})
+		if err != nil {
+			log.Printf("Error saving run status: %v", err)
+		}
+		redismethods.FinishRun(ctx, rdb, "subfinder")
 
 		// Wait 60 minutes before next run
 		fmt.Printf("Waiting 60 minutes until next run...\n")
-		time.Sleep(60 * time.Minute)
+		redismethods.WaitForNextRun(ctx, rdb, "subfinder", 60*time.Minute)
 	}
 }
 
-// queryAnubis queries the Anubis API for subdomains
-func queryAnubis(client *http.Client, domain string) ([]string, error) {
-	anubisURL := fmt.Sprintf("https://anubisdb.com/anubis/subdomains/%s", domain)
-
-	req, err := http.NewRequest("GET", anubisURL, nil)
+// enumerateActive bruteforces and permutes the roots of the programs opted in to active
+// enumeration. Hits in the scope of one of these programs are added to found, with active
+// as their source, and their count is returned.
+func enumerateActive(ctx context.Context, resolver *subdomains.Resolver, scopes subdomains.Scopes, groups map[string][]string, programs []string, found map[string]bool, attribution map[string][]string) int {
+	words, err := subdomains.LoadWordlist(env.Env["SUBFINDER_WORDLIST"])
 	if err != nil {
-		return nil, err
+		log.Printf("Error loading wordlist: %v", err)
+		return 0
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; SecurityScanner/1.0)")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	rootSet := make(map[string]bool)
+	for _, program := range programs {
+		for _, entry := range groups[program] {
+			if root := subdomains.EnumerationRoot(entry); root != "" {
+				rootSet[root] = true
+			}
+		}
+	}
+	roots := make([]string, 0, len(rootSet))
+	for root := range rootSet {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	var known []string
+	for host := range found {
+		for _, root := range roots {
+			if subdomains.IsSubdomainOf(host, root) {
+				known = append(known, host)
+				break
+			}
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("anubis API returned status: %d", resp.StatusCode)
+	candidates := subdomains.Candidates(roots, words, known, env.GetInt("SUBFINDER_ACTIVE_MAX", 10000))
+	fmt.Printf("Active enumeration of %d programs: %d roots, %d candidates\n", len(programs), len(roots), len(candidates))
+	hits := resolver.ResolveCandidates(ctx, candidates)
+
+	count := 0
+	for host := range hits {
+		inScope := false
+		for _, program := range scopes.Programs(host) {
+			for _, active := range programs {
+				inScope = inScope || program == active
+			}
+		}
+		if !inScope {
+			continue
+		}
+		found[host] = true
+		attribution[host] = append(attribution[host], "active")
+		count++
 	}
+	fmt.Printf("Active enumeration found %d subdomains\n", count)
+	return count
+}
 
-	var subdomains []string
-	err = json.NewDecoder(resp.Body).Decode(&subdomains)
-	if err != nil {
-		return nil, err
+// splitList returns the non-empty comma separated values of s
+func splitList(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
 	}
+	return values
+}
+
+// legacySnapshotKey is the snapshot of every subdomain saved by older versions
+const legacySnapshotKey = "anubis:previous_subdomains"
 
-	return subdomains, nil
+// domainSnapshotKey and programSnapshotKey name the subdomain snapshots of a root domain
+// and of a program
+func domainSnapshotKey(root string) string {
+	return "subfinder:domain:" + root
 }
 
-func compareAndSave(ctx context.Context, rdb *redis.Client, current []string) {
-	// Get previous subdomains
-	previousData, err := rdb.Get(ctx, "anubis:previous_subdomains").Result()
+func programSnapshotKey(program string) string {
+	return "subfinder:program:" + program
+}
 
-	var previous []string
-	if err == nil {
-		json.Unmarshal([]byte(previousData), &previous)
+// compareAndSave diffs the subdomains of every root domain with its previous snapshot. A
+// missing subdomain is kept, not removed, when one of the sources that reported it failed.
+// Subdomains added to a program's snapshot that resolve are notified per program, along with
+// known ones that started resolving (live). Ignored subdomains are never added nor removed.
+func compareAndSave(ctx context.Context, rdb *redis.Client, store storage.SnapshotStore, roots []string, results map[string]*subdomains.DomainResult, scopes subdomains.Scopes, current []string, ignored map[string]bool, resolutions map[string]subdomains.Resolution, live []string, runID string) (int, int) {
+	// The global snapshot of older versions is the baseline of roots never saved on their own,
+	// it is deleted once every root has its snapshot
+	legacy, err := store.Load(ctx, legacySnapshotKey)
+	hasLegacy := err == nil
+	if err != nil && err != storage.ErrNoSnapshot {
+		log.Printf("Error loading previous subdomains: %v", err)
 	}
+	migrated := true
+
+	addedSet := make(map[string]bool)
+	removedSet := make(map[string]bool)
+	kept := make(map[string]bool)
+
+	for _, root := range roots {
+		var hosts []string
+		for _, sub := range current {
+			if subdomains.IsSubdomainOf(sub, root) {
+				hosts = append(hosts, sub)
+			}
+		}
+
+		previous, err := store.Load(ctx, domainSnapshotKey(root))
+		if err == storage.ErrNoSnapshot {
+			for _, sub := range legacy {
+				if subdomains.IsSubdomainOf(sub, root) {
+					previous = append(previous, sub)
+				}
+			}
+		} else if err != nil {
+			// Overwriting a snapshot that could not be read would lose it, its subdomains are
+			// still kept for the program snapshots
+			log.Printf("Error loading snapshot of %s: %v", root, err)
+			for _, sub := range hosts {
+				kept[sub] = true
+			}
+			migrated = false
+			continue
+		}
+
+		// Ignored subdomains already in the snapshot stay there, new ones are left out
+		known := make(map[string]bool, len(previous))
+		for _, sub := range previous {
+			known[sub] = true
+		}
+		tracked := hosts[:0]
+		for _, sub := range hosts {
+			if !ignored[sub] || known[sub] {
+				tracked = append(tracked, sub)
+			}
+		}
+		hosts = tracked
+
+		rootAdded, missing := redismethods.CompareUniqueURLs(previous, hosts)
+		missing, rootRemoved := keepMissing(ctx, rdb, results[root], missing)
+		if len(missing) > 0 {
+			fmt.Printf("Keeping %d previous subdomains of %s, their sources failed\n", len(missing), root)
+			hosts = append(hosts, missing...)
+		}
+
+		for _, sub := range rootAdded {
+			addedSet[sub] = true
+		}
+		for _, sub := range rootRemoved {
+			removedSet[sub] = true
+		}
+		for _, sub := range hosts {
+			kept[sub] = true
+		}
 
-	// Convert to sets for comparison
-	currentSet := make(map[string]bool)
-	previousSet := make(map[string]bool)
+		err = store.Save(ctx, domainSnapshotKey(root), hosts)
+		if err != nil {
+			log.Printf("Error saving snapshot of %s: %v", root, err)
+			migrated = false
+		}
+	}
 
-	for _, sub := range current {
-		currentSet[sub] = true
+	if hasLegacy && migrated {
+		err = store.Delete(ctx, legacySnapshotKey)
+		if err != nil {
+			log.Printf("Error deleting previous subdomains: %v", err)
+		} else {
+			fmt.Println("Previous subdomains migrated to per domain snapshots")
+		}
 	}
-	for _, sub := range previous {
-		previousSet[sub] = true
+
+	// A subdomain under several roots is removed only if no root kept it
+	for sub := range removedSet {
+		if kept[sub] {
+			delete(removedSet, sub)
+		}
 	}
 
-	// Find differences
-	added := make([]string, 0)
-	removed := make([]string, 0)
+	// Program snapshots tie every subdomain back to the programs whose scope contains it. A
+	// subdomain is added to a program when it is missing from its snapshot, so subdomains that
+	// enter the scope of a program are reported too.
+	programAdded := make(map[string][]string)
+	for program, scope := range scopes {
+		var hosts []string
+		for sub := range kept {
+			if scope.Contains(sub) {
+				hosts = append(hosts, sub)
+			}
+		}
+		if program == "" {
+			// Subdomains not grouped by program only have the diff of their root
+			programAdded[program] = inScope(scope, addedSet)
+			continue
+		}
+
+		previous, err := store.Load(ctx, programSnapshotKey(program))
+		if err == storage.ErrNoSnapshot {
+			// A program seen for the first time only gets the subdomains new to their root
+			programAdded[program] = inScope(scope, addedSet)
+		} else if err != nil {
+			log.Printf("Error loading snapshot of %s: %v", program, err)
+			continue
+		} else {
+			programAdded[program], _ = redismethods.CompareUniqueURLs(previous, hosts)
+		}
 
-	for sub := range currentSet {
-		if !previousSet[sub] {
-			added = append(added, sub)
+		err = store.Save(ctx, programSnapshotKey(program), hosts)
+		if err != nil {
+			log.Printf("Error saving snapshot of %s: %v", program, err)
 		}
 	}
 
-	for sub := range previousSet {
-		if !currentSet[sub] {
-			removed = append(removed, sub)
+	// Added subdomains that do not resolve are counted but not listed
+	addedResolving := make(map[string][]string)
+	resolving := make(map[string]bool)
+	for program, hosts := range programAdded {
+		for _, sub := range hosts {
+			if resolutions[sub].Live() {
+				addedResolving[program] = append(addedResolving[program], sub)
+				resolving[sub] = true
+			}
 		}
 	}
 
 	// Print results
 	fmt.Printf("\n=== CHANGES DETECTED ===\n")
-	fmt.Printf("Added: %d subdomains\n", len(added))
-	fmt.Printf("Removed: %d subdomains\n", len(removed))
+	fmt.Printf("Added: %d subdomains (%d resolving)\n", len(addedSet), len(resolving))
+	fmt.Printf("Removed: %d subdomains\n", len(removedSet))
+	fmt.Printf("Now resolving: %d subdomains\n", len(live))
 
 	// Send notification if changes detected
-	if len(added) > 0 || len(removed) > 0 {
+	if len(addedSet) > 0 || len(resolving) > 0 || len(removedSet) > 0 || len(live) > 0 {
 		// Send summary first
-		summary := fmt.Sprintf("Subdomain Changes Detected\nAdded: %d | Removed: %d", len(added), len(removed))
-		err = rdb.Publish(ctx, "telegram_notifications", summary).Err()
+		summary := events.New("subfinder", "", "", events.KindSubdomainsChanged, events.SeverityLow, runID)
+		summary.Message = fmt.Sprintf("Added: %d (%d resolving) | Removed: %d | Now resolving: %d", len(addedSet), len(resolving), len(removedSet), len(live))
+		err = redismethods.PublishEvent(ctx, rdb, summary)
 		if err != nil {
 			log.Printf("Error publishing summary notification: %v", err)
 		} else {
 			fmt.Println("Summary sent to Telegram")
 		}
 
-		// Send added subdomains in chunks of 10
-		if len(added) > 0 {
-			sendInChunks(ctx, rdb, added, "🆕 Added Subdomains", 30)
+		// Send added subdomains, one event per program
+		for program, hosts := range addedResolving {
+			publishSubdomains(ctx, rdb, program, hosts, events.KindSubdomainsAdded, runID)
 		}
 
-		// Send removed subdomains in chunks of 10
-		if len(removed) > 0 {
-			//sendInChunks(ctx, rdb, removed, "🗑️ Removed Subdomains", 30)
+		// Send known subdomains that started resolving
+		for program, hosts := range byProgram(scopes, live) {
+			publishSubdomains(ctx, rdb, program, hosts, events.KindSubdomainsLive, runID)
 		}
 
 		fmt.Println("All notifications sent to Telegram")
@@ -203,70 +509,193 @@ func compareAndSave(ctx context.Context, rdb *redis.Client, current []string) {
 		fmt.Println("No changes detected since last run")
 	}
 
-	// Save current as new previous
-	currentData, _ := json.Marshal(current)
-	err = rdb.Set(ctx, "anubis:previous_subdomains", currentData, 7*24*time.Hour).Err()
-	if err != nil {
-		log.Printf("Error saving to Redis: %v", err)
-	} else {
-		fmt.Println("Results saved for next comparison")
-	}
+	return len(addedSet), len(removedSet)
 }
 
-// sendInChunks sends domains in chunks of specified size
-func sendInChunks(ctx context.Context, rdb *redis.Client, domains []string, title string, chunkSize int) {
-	totalDomains := len(domains)
-	totalChunks := (totalDomains + chunkSize - 1) / chunkSize // Ceiling division
+// keepMissing splits the subdomains missing from a root into the ones kept, because a source
+// that reported them failed this run, and the removed ones. Subdomains whose sources were
+// never recorded are kept as soon as any source failed.
+func keepMissing(ctx context.Context, rdb *redis.Client, result *subdomains.DomainResult, missing []string) ([]string, []string) {
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	if result == nil {
+		// The root was not enumerated at all
+		return missing, nil
+	}
+	if len(result.Failed) == 0 {
+		return nil, missing
+	}
 
-	fmt.Printf("Sending %d %s in %d chunks...\n", totalDomains, strings.ToLower(title), totalChunks)
+	sources, err := redismethods.GetSubdomainSources(ctx, rdb, missing)
+	if err != nil {
+		log.Printf("Error getting sources of missing subdomains: %v", err)
+		return missing, nil
+	}
+	failed := make(map[string]bool, len(result.Failed))
+	for _, name := range result.Failed {
+		failed[name] = true
+	}
 
-	for i := 0; i < totalDomains; i += chunkSize {
-		end := i + chunkSize
-		if end > totalDomains {
-			end = totalDomains
+	var kept, removed []string
+	for _, host := range missing {
+		names, recorded := sources[host]
+		keep := !recorded
+		for _, name := range names {
+			keep = keep || failed[name]
 		}
+		if keep {
+			kept = append(kept, host)
+		} else {
+			removed = append(removed, host)
+		}
+	}
+	return kept, removed
+}
 
-		chunk := domains[i:end]
-		chunkNumber := (i / chunkSize) + 1
-
-		// Format the message
-		message := formatChunkMessage(chunk, title, chunkNumber, totalChunks)
+// inScope returns the subdomains of the set that the scope contains
+func inScope(scope *subdomains.Scope, set map[string]bool) []string {
+	var hosts []string
+	for host := range set {
+		if scope.Contains(host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
 
-		// Send to Telegram
-		err := rdb.Publish(ctx, "telegram_notifications", message).Err()
-		if err != nil {
-			log.Printf("Error publishing %s chunk %d: %v", title, chunkNumber, err)
-		} else {
-			fmt.Printf("✓ Sent %s - Part %d/%d: %d domains\n",
-				strings.ToLower(title), chunkNumber, totalChunks, len(chunk))
+// byProgram groups the subdomains by the programs whose scope contains them
+func byProgram(scopes subdomains.Scopes, hosts []string) map[string][]string {
+	groups := make(map[string][]string)
+	for _, host := range hosts {
+		for _, program := range scopes.Programs(host) {
+			groups[program] = append(groups[program], host)
 		}
+	}
+	return groups
+}
+
+// programEvent returns a subfinder event of the program. Subdomains are matched against the
+// HackerOne scopes, the program is on that platform.
+func programEvent(program string, kind events.Kind, severity events.Severity, runID string) events.Event {
+	platform := ""
+	if program != "" {
+		platform = "hackerone"
+	}
+	return events.New("subfinder", platform, program, kind, severity, runID)
+}
 
-		// Small delay to avoid rate limiting
-		time.Sleep(3100 * time.Millisecond)
+// hostPrograms returns the programs whose scope contains the host, a single "" when none does
+func hostPrograms(scopes subdomains.Scopes, host string) []string {
+	programs := scopes.Programs(host)
+	if len(programs) == 0 {
+		return []string{""}
 	}
+	return programs
 }
 
-// formatChunkMessage creates a formatted message for a chunk of domains
-func formatChunkMessage(domains []string, title string, chunkNum, totalChunks int) string {
-	domainsText := strings.Join(domains, "\n")
+// publishSubdomains sends the domains as a single event, the notifiers attach long lists as a document
+func publishSubdomains(ctx context.Context, rdb *redis.Client, program string, domains []string, kind events.Kind, runID string) {
+	event := programEvent(program, kind, events.SeverityLow, runID)
+	event.Assets = domains
 
-	return fmt.Sprintf("%s (%d/%d) - %d domains:\n%s",
-		title, chunkNum, totalChunks, len(domains), domainsText)
+	err := redismethods.PublishEvent(ctx, rdb, event)
+	if err != nil {
+		log.Printf("Error publishing %s: %v", kind, err)
+	} else {
+		fmt.Printf("✓ Sent %s: %d domains\n", kind, len(domains))
+	}
 }
 
-// extractDomain extracts domain from URL or wildcard
-// extractDomain extracts only the main domain from URL or wildcard
-func extractDomain(input string) string {
-	// Use publicsuffix to get the main domain first
-	input = strings.TrimPrefix(input, "https://")
-	input = strings.TrimPrefix(input, "http://")
-	input = strings.SplitN(input, "/", 2)[0]
+// probeHosts probes the hosts and publishes an event for every known host whose endpoints
+// changed. It returns how many hosts responded and how many changed.
+func probeHosts(ctx context.Context, rdb *redis.Client, prober *subdomains.Prober, scopes subdomains.Scopes, hosts []string, runID string) (int, int) {
+	previous, err := redismethods.GetProbes(ctx, rdb, hosts)
+	if err != nil {
+		log.Printf("Error getting previous probes: %v", err)
+		return 0, 0
+	}
+	probes := prober.ProbeAll(ctx, hosts)
+	responding := len(probes)
+	fmt.Printf("Probed %d hosts: %d responding\n", len(hosts), responding)
+
+	changed := 0
+	for _, host := range hosts {
+		before, known := previous[host]
+		after := probes[host]
+		if after == nil {
+			// Saved empty so a host that starts responding later is reported, and one that
+			// stopped is not reported again
+			probes[host] = []subdomains.ProbeResult{}
+		}
+		if !known {
+			continue
+		}
+		changes := subdomains.DiffProbes(before, after)
+		if len(changes) == 0 {
+			continue
+		}
+		changed++
+
+		for _, program := range hostPrograms(scopes, host) {
+			event := programEvent(program, events.KindHTTPChanged, events.SeverityLow, runID)
+			event.Assets = []string{host}
+			event.Message = strings.Join(changes, "\n")
+			err = redismethods.PublishEvent(ctx, rdb, event)
+			if err != nil {
+				log.Printf("Error publishing HTTP changes of %s: %v", host, err)
+			}
+		}
+	}
+
+	err = redismethods.SaveProbes(ctx, rdb, probes)
+	if err != nil {
+		log.Printf("Error saving probes: %v", err)
+	}
+	return responding, changed
+}
 
-	domain, err := publicsuffix.EffectiveTLDPlusOne(input)
+// checkTakeovers looks for takeover candidates among the resolutions and alerts on the new
+// ones, a candidate already alerted on is not alerted again until it goes away. It returns
+// how many candidates there are.
+func checkTakeovers(ctx context.Context, rdb *redis.Client, checker *subdomains.TakeoverChecker, scopes subdomains.Scopes, resolutions map[string]subdomains.Resolution, runID string) int {
+	known, err := redismethods.GetTakeovers(ctx, rdb)
 	if err != nil {
-		// If publicsuffix fails, fallback to cleaning the input
-		domain = input
+		log.Printf("Error getting takeover candidates: %v", err)
+		return 0
+	}
+	candidates := checker.CheckAll(ctx, resolutions)
+	fmt.Printf("Found %d takeover candidates\n", len(candidates))
+
+	for host, candidate := range candidates {
+		if previous, ok := known[host]; ok && previous.Service == candidate.Service {
+			continue
+		}
+		for _, program := range hostPrograms(scopes, host) {
+			event := programEvent(program, events.KindTakeover, events.SeverityHigh, runID)
+			event.Assets = []string{host}
+			event.Message = fmt.Sprintf("Service: %s\nCNAME: %s\nEvidence: %s", candidate.Service, strings.Join(candidate.CNAME, " -> "), candidate.Evidence)
+			err = redismethods.PublishEvent(ctx, rdb, event)
+			if err != nil {
+				log.Printf("Error publishing takeover candidate %s: %v", host, err)
+			}
+		}
 	}
 
-	return domain
+	// Resolved hosts that are no longer candidates were fixed or claimed
+	var cleared []string
+	for host := range known {
+		if _, resolved := resolutions[host]; resolved && candidates[host].Host == "" {
+			cleared = append(cleared, host)
+		}
+	}
+	err = redismethods.RemoveTakeovers(ctx, rdb, cleared)
+	if err != nil {
+		log.Printf("Error removing takeover candidates: %v", err)
+	}
+	err = redismethods.SaveTakeovers(ctx, rdb, candidates)
+	if err != nil {
+		log.Printf("Error saving takeover candidates: %v", err)
+	}
+	return len(candidates)
 }
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"BugBountyGoApiWrapper/redismethods"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type update struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Text string `json:"text"`
+		From *struct {
+			ID int64 `json:"id"`
+		} `json:"from"`
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+	} `json:"message"`
+}
+
+type updatesResponse struct {
+	Ok     bool     `json:"ok"`
+	Result []update `json:"result"`
+}
+
+// adminCommands change what is monitored or start work, only admins may run them
+var adminCommands = map[string]bool{"/run": true, "/filter": true, "/active": true}
+
+// commandHandler answers bot commands from the authorized chats, admin commands only
+// from the Admins user IDs
+type commandHandler struct {
+	Bot        *telegramBot
+	Redis      *redis.Client
+	Authorized map[string]bool
+	Admins     map[string]bool
+}
+
+// poll long-polls getUpdates forever and answers every command received
+func (h *commandHandler) poll(ctx context.Context) {
+	client := &http.Client{Timeout: 60 * time.Second}
+	var offset int64
+
+	for {
+		updates, err := getUpdates(client, h.Bot.Token, offset)
+		if err != nil {
+			log.Printf("Error getting updates: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			if u.Message == nil || !strings.HasPrefix(u.Message.Text, "/") {
+				continue
+			}
+
+			chatID := strconv.FormatInt(u.Message.Chat.ID, 10)
+			if !h.Authorized[chatID] {
+				log.Printf("Ignoring command from unauthorized chat %s", chatID)
+				continue
+			}
+
+			userID := ""
+			if u.Message.From != nil {
+				userID = strconv.FormatInt(u.Message.From.ID, 10)
+			}
+			reply := h.handle(ctx, u.Message.Text, userID)
+			for _, part := range splitMessage(reply, telegramMaxLength) {
+				err = h.Bot.Queue.Send(chatID, func() error {
+					return sendToTelegram(h.Bot.Token, chatTarget{ChatID: chatID}, part, "")
+				})
+				if err != nil {
+					log.Printf("Error answering command: %v", err)
+				}
+			}
+		}
+	}
+}
+
+func getUpdates(client *http.Client, botToken string, offset int64) ([]update, error) {
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/getUpdates?timeout=50&offset=%d", botToken, offset)
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var response updatesResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding updates: %w", err)
+	}
+	if !response.Ok {
+		return nil, fmt.Errorf("telegram API error: %s", resp.Status)
+	}
+	return response.Result, nil
+}
+
+// handle runs a command sent by userID and returns the text of the reply
+func (h *commandHandler) handle(ctx context.Context, text string, userID string) string {
+	fields := strings.Fields(text)
+	// Commands in groups may be suffixed with the bot name, /status@mybot
+	command := strings.SplitN(fields[0], "@", 2)[0]
+	args := fields[1:]
+
+	if adminCommands[command] && !h.Admins[userID] {
+		log.Printf("Refusing %s from user %q, not an admin", command, userID)
+		return fmt.Sprintf("%s is restricted to the admins in TELEGRAM_ADMIN_USER_IDS", command)
+	}
+
+	var reply string
+	var err error
+	switch command {
+	case "/status":
+		reply, err = h.status(ctx)
+	case "/programs":
+		reply, err = h.programs(ctx)
+	case "/scope":
+		if len(args) != 1 {
+			return "Usage: /scope <program>"
+		}
+		reply, err = h.scope(ctx, args[0])
+	case "/diff":
+		if len(args) != 2 {
+			return "Usage: /diff <program> <since>, e.g. /diff security 7d"
+		}
+		reply, err = h.diff(ctx, args[0], args[1])
+	case "/mute":
+		if len(args) != 2 {
+			return "Usage: /mute <program> <duration>, e.g. /mute security 12h"
+		}
+		reply, err = h.mute(ctx, args[0], args[1])
+	case "/run":
+		reply, err = h.run(ctx)
+	case "/filter":
+		reply, err = h.filter(ctx, args)
+	case "/active":
+		reply, err = h.active(ctx, args)
+	default:
+		return "Commands: /status, /programs, /scope <program>, /diff <program> <since>, /mute <program> <duration>, /run, /filter, /active"
+	}
+
+	if err != nil {
+		log.Printf("Error running %s: %v", command, err)
+		return fmt.Sprintf("Error: %v", err)
+	}
+	return reply
+}
+
+func (h *commandHandler) status(ctx context.Context) (string, error) {
+	var sb strings.Builder
+	for _, source := range redismethods.Sources {
+		status, err := redismethods.GetRunStatus(ctx, h.Redis, source)
+		if err != nil {
+			return "", err
+		}
+		if len(status) == 0 {
+			fmt.Fprintf(&sb, "%s: never ran\n", source)
+			continue
+		}
+
+		fmt.Fprintf(&sb, "%s: last run %s\n", source, status["last_run"])
+		var names []string
+		for name := range status {
+			if name != "last_run" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&sb, "  %s: %s\n", name, status[name])
+		}
+	}
+	return sb.String(), nil
+}
+
+func (h *commandHandler) programs(ctx context.Context) (string, error) {
+	programs, err := redismethods.GetTrackedPrograms(ctx, h.Redis, "hackerone")
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(programs)
+	return fmt.Sprintf("Tracked programs (%d):\n%s", len(programs), strings.Join(programs, "\n")), nil
+}
+
+func (h *commandHandler) scope(ctx context.Context, program string) (string, error) {
+	records, err := redismethods.GetAssetRecords(ctx, h.Redis, "hackerone", program)
+	if err != nil {
+		return "", err
+	}
+
+	var assets []string
+	for asset, record := range records {
+		if record.Present {
+			assets = append(assets, fmt.Sprintf("%s (since %s)", asset, record.FirstSeen.Format("2006-01-02")))
+		}
+	}
+	if len(assets) == 0 {
+		return fmt.Sprintf("No assets in scope for %s", program), nil
+	}
+	sort.Strings(assets)
+	return fmt.Sprintf("Scope of %s (%d):\n%s", program, len(assets), strings.Join(assets, "\n")), nil
+}
+
+func (h *commandHandler) diff(ctx context.Context, program, since string) (string, error) {
+	from, err := parseSince(since)
+	if err != nil {
+		return "", err
+	}
+	changes, err := redismethods.GetProgramChanges(ctx, h.Redis, "hackerone", program, from)
+	if err != nil {
+		return "", err
+	}
+	if len(changes) == 0 {
+		return fmt.Sprintf("No changes in %s since %s", program, from.Format("2006-01-02 15:04")), nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Changes in %s since %s (%d):\n", program, from.Format("2006-01-02 15:04"), len(changes))
+	for _, change := range changes {
+		fmt.Fprintf(&sb, "%s %s %s\n", change.Time.Format("2006-01-02 15:04"), change.Kind, change.Asset)
+	}
+	return sb.String(), nil
+}
+
+func (h *commandHandler) mute(ctx context.Context, program, duration string) (string, error) {
+	d, err := parseDuration(duration)
+	if err != nil {
+		return "", err
+	}
+	err = redismethods.MuteProgram(ctx, h.Redis, program, d)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s muted until %s", program, time.Now().Add(d).Format("2006-01-02 15:04")), nil
+}
+
+func (h *commandHandler) run(ctx context.Context) (string, error) {
+	for _, source := range redismethods.Sources {
+		err := redismethods.RequestRun(ctx, h.Redis, source)
+		if err != nil {
+			return "", err
+		}
+	}
+	return "Run requested for " + strings.Join(redismethods.Sources, ", "), nil
+}
+
+const activeUsage = `Usage:
+/active list
+/active on <program>
+/active off <program>`
+
+// active opts programs in and out of active subdomain enumeration
+func (h *commandHandler) active(ctx context.Context, args []string) (string, error) {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		programs, err := redismethods.GetActivePrograms(ctx, h.Redis)
+		if err != nil {
+			return "", err
+		}
+		if len(programs) == 0 {
+			return "No program opted in to active enumeration", nil
+		}
+		sort.Strings(programs)
+		return fmt.Sprintf("Active enumeration (%d):\n%s", len(programs), strings.Join(programs, "\n")), nil
+	case len(args) == 2 && (args[0] == "on" || args[0] == "off"):
+		err := redismethods.SetActiveEnumeration(ctx, h.Redis, args[1], args[0] == "on")
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Active enumeration of %s turned %s", args[1], args[0]), nil
+	default:
+		return activeUsage, nil
+	}
+}
+
+const filterUsage = `Usage:
+/filter list
+/filter add <include|exclude> [program=a,b] [platform=hackerone] [kind=assets_added] [pattern=regexp] [type=wildcard,url,domain,ip,cidr] [tld=gov,mil] [bounty] [for=7d]
+/filter del <id>`
+
+func (h *commandHandler) filter(ctx context.Context, args []string) (string, error) {
+	if len(args) == 0 {
+		return filterUsage, nil
+	}
+
+	switch args[0] {
+	case "list":
+		rules, err := redismethods.GetFilters(ctx, h.Redis)
+		if err != nil {
+			return "", err
+		}
+		if len(rules) == 0 {
+			return "No filters, every notification is delivered", nil
+		}
+		var sb strings.Builder
+		for _, rule := range rules {
+			fmt.Fprintf(&sb, "#%d %s\n", rule.ID, describeFilter(rule))
+		}
+		return sb.String(), nil
+	case "add":
+		if len(args) < 2 {
+			return filterUsage, nil
+		}
+		rule, err := parseFilter(args[1], args[2:])
+		if err != nil {
+			return "", err
+		}
+		rule, err = redismethods.AddFilter(ctx, h.Redis, rule)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Added filter #%d %s", rule.ID, describeFilter(rule)), nil
+	case "del":
+		if len(args) != 2 {
+			return filterUsage, nil
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(args[1], "#"), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid filter ID: %s", args[1])
+		}
+		removed, err := redismethods.RemoveFilter(ctx, h.Redis, id)
+		if err != nil {
+			return "", err
+		}
+		if !removed {
+			return fmt.Sprintf("No filter #%d", id), nil
+		}
+		return fmt.Sprintf("Removed filter #%d", id), nil
+	default:
+		return filterUsage, nil
+	}
+}
+
+// parseFilter builds a rule from the key=value arguments of /filter add
+func parseFilter(action string, args []string) (redismethods.FilterRule, error) {
+	rule := redismethods.FilterRule{Action: action}
+	for _, arg := range args {
+		key, value, _ := strings.Cut(arg, "=")
+		list := strings.Split(value, ",")
+		switch key {
+		case "program":
+			rule.Programs = list
+		case "platform":
+			rule.Platforms = list
+		case "kind":
+			rule.Kinds = list
+		case "pattern":
+			rule.AssetPattern = value
+		case "type":
+			rule.AssetTypes = list
+		case "tld":
+			for _, tld := range list {
+				rule.TLDs = append(rule.TLDs, strings.TrimPrefix(tld, "."))
+			}
+		case "bounty":
+			rule.BountyOnly = true
+		case "for":
+			d, err := parseDuration(value)
+			if err != nil {
+				return rule, err
+			}
+			rule.Until = time.Now().Add(d)
+		default:
+			return rule, fmt.Errorf("unknown filter field: %s", key)
+		}
+	}
+	return rule, nil
+}
+
+// describeFilter returns the rule in the /filter add syntax
+func describeFilter(rule redismethods.FilterRule) string {
+	parts := []string{rule.Action}
+	for _, field := range []struct {
+		name   string
+		values []string
+	}{
+		{"program", rule.Programs},
+		{"platform", rule.Platforms},
+		{"kind", rule.Kinds},
+		{"type", rule.AssetTypes},
+		{"tld", rule.TLDs},
+	} {
+		if len(field.values) > 0 {
+			parts = append(parts, field.name+"="+strings.Join(field.values, ","))
+		}
+	}
+	if rule.AssetPattern != "" {
+		parts = append(parts, "pattern="+rule.AssetPattern)
+	}
+	if rule.BountyOnly {
+		parts = append(parts, "bounty")
+	}
+	if !rule.Until.IsZero() {
+		parts = append(parts, "until "+rule.Until.Format("2006-01-02 15:04"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseDuration accepts Go durations plus a day suffix, e.g. 7d
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+	return d, nil
+}
+
+// parseSince accepts a duration back from now, e.g. 7d, or a date, e.g. 2024-01-31
+func parseSince(s string) (time.Time, error) {
+	date, err := time.Parse("2006-01-02", s)
+	if err == nil {
+		return date, nil
+	}
+	d, err := parseDuration(s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-d), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// attachAssets moves the asset list of a large event into a .txt or .csv document,
+// leaving a short summary as the message text
+func attachAssets(event events.Event, threshold int, format string) events.Event {
+	if threshold <= 0 || len(event.Assets) <= threshold || event.Attachment != nil {
+		return event
+	}
+
+	name := string(event.Kind)
+	if event.Program != "" {
+		name = event.Program + "-" + name
+	}
+	filename := fmt.Sprintf("%s-%s", name, event.Timestamp.Format("20060102-150405"))
+
+	var content string
+	if format == "csv" {
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		writer.Write([]string{"asset", "platform", "program", "kind", "timestamp"})
+		for _, asset := range event.Assets {
+			writer.Write([]string{asset, event.Platform, event.Program, string(event.Kind), event.Timestamp.Format(time.RFC3339)})
+		}
+		writer.Flush()
+		content = buf.String()
+		filename += ".csv"
+	} else {
+		content = strings.Join(event.Assets, "\n") + "\n"
+		filename += ".txt"
+	}
+
+	summary := event
+	summary.Message = strings.TrimSpace(fmt.Sprintf("%s\n%d assets, full list attached", event.Message, len(event.Assets)))
+	summary.Assets = nil
+	summary.Attachment = &events.Attachment{
+		Filename: filename,
+		Caption:  fmt.Sprintf("%s (%d)", event.Title(), len(event.Assets)),
+		Content:  content,
+	}
+	return summary
+}
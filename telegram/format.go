@@ -0,0 +1,180 @@
+package main
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf16"
+)
+
+// telegramMaxLength is the maximum length of a Telegram message text
+const telegramMaxLength = 4096
+
+const (
+	parseModeHTML       = "HTML"
+	parseModeMarkdownV2 = "MarkdownV2"
+)
+
+var markdownV2Escaper = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)",
+	"~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=",
+	"|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+)
+
+var markdownV2CodeEscaper = strings.NewReplacer("\\", "\\\\", "`", "\\`")
+
+var markdownV2LinkEscaper = strings.NewReplacer("\\", "\\\\", ")", "\\)")
+
+// escapeText escapes plain text for the parse mode
+func escapeText(text, parseMode string) string {
+	switch parseMode {
+	case parseModeHTML:
+		return html.EscapeString(text)
+	case parseModeMarkdownV2:
+		return markdownV2Escaper.Replace(text)
+	default:
+		return text
+	}
+}
+
+func bold(text, parseMode string) string {
+	switch parseMode {
+	case parseModeHTML:
+		return "<b>" + html.EscapeString(text) + "</b>"
+	case parseModeMarkdownV2:
+		return "*" + markdownV2Escaper.Replace(text) + "*"
+	default:
+		return text
+	}
+}
+
+func code(text, parseMode string) string {
+	switch parseMode {
+	case parseModeHTML:
+		return "<code>" + html.EscapeString(text) + "</code>"
+	case parseModeMarkdownV2:
+		return "`" + markdownV2CodeEscaper.Replace(text) + "`"
+	default:
+		return text
+	}
+}
+
+func link(text, url, parseMode string) string {
+	if url == "" {
+		return escapeText(text, parseMode)
+	}
+	switch parseMode {
+	case parseModeHTML:
+		return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(url), html.EscapeString(text))
+	case parseModeMarkdownV2:
+		return fmt.Sprintf("[%s](%s)", markdownV2Escaper.Replace(text), markdownV2LinkEscaper.Replace(url))
+	default:
+		return text
+	}
+}
+
+// formatEvent renders an event for the parse mode. Every line is a complete
+// fragment so the text can be split on line boundaries without breaking markup.
+func formatEvent(event events.Event, parseMode string) string {
+	if event.Kind == events.KindText || parseMode == "" {
+		return event.Render()
+	}
+
+	var lines []string
+	title := event.Title()
+	if event.Severity == events.SeverityHigh {
+		title += " [HIGH]"
+	}
+	lines = append(lines, bold(title, parseMode))
+	if event.Platform != "" {
+		lines = append(lines, escapeText("Platform: ", parseMode)+escapeText(event.Platform, parseMode))
+	}
+	if event.Program != "" {
+		lines = append(lines, escapeText("Program: ", parseMode)+link(event.Program, events.ProgramURL(event.Platform, event.Program), parseMode))
+	}
+	for _, line := range strings.Split(event.Message, "\n") {
+		if line != "" {
+			lines = append(lines, escapeText(line, parseMode))
+		}
+	}
+	if len(event.Assets) > 0 {
+		lines = append(lines, escapeText(fmt.Sprintf("Assets (%d):", len(event.Assets)), parseMode))
+		for _, asset := range event.Assets {
+			lines = append(lines, code(asset, parseMode))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// utf16Len returns the length of s in UTF-16 code units, which Telegram limits count
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// cutUTF16 cuts s after at most limit UTF-16 code units, without splitting a character.
+// At least one character is cut so that callers always make progress.
+func cutUTF16(s string, limit int) (string, string) {
+	n := 0
+	for i, r := range s {
+		n += utf16.RuneLen(r)
+		if n > limit && i > 0 {
+			return s[:i], s[i:]
+		}
+	}
+	return s, ""
+}
+
+// splitMessage splits text into parts of at most limit UTF-16 code units, on line boundaries.
+// A single line longer than limit is cut, which only happens for plain text in practice.
+func splitMessage(text string, limit int) []string {
+	if utf16Len(text) <= limit {
+		return []string{text}
+	}
+
+	var parts []string
+	var current strings.Builder
+	currentLen := 0
+	started := false
+
+	flush := func() {
+		// Telegram rejects messages with nothing but whitespace
+		if started && strings.TrimSpace(current.String()) != "" {
+			parts = append(parts, current.String())
+		}
+		current.Reset()
+		currentLen = 0
+		started = false
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		lineLen := utf16Len(line)
+
+		for lineLen > limit {
+			flush()
+			head, tail := cutUTF16(line, limit)
+			parts = append(parts, head)
+			line = tail
+			lineLen -= utf16Len(head)
+		}
+
+		// +1 for the newline joining the line to the current part
+		if started && currentLen+1+lineLen > limit {
+			flush()
+		}
+		if started {
+			current.WriteString("\n")
+			currentLen++
+		}
+		current.WriteString(line)
+		currentLen += lineLen
+		started = true
+	}
+	flush()
+
+	return parts
+}
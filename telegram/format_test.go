@@ -0,0 +1,98 @@
+package main
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		parts []string
+	}{
+		{name: "fits", text: "one\ntwo", limit: 7, parts: []string{"one\ntwo"}},
+		{name: "on line boundaries", text: "one\ntwo\nthree", limit: 8, parts: []string{"one\ntwo", "three"}},
+		{name: "long line cut", text: "abcdefgh\nij", limit: 3, parts: []string{"abc", "def", "gh", "ij"}},
+		// Joined back with the newline they were split on, the parts give the text again
+		{name: "blank lines kept", text: "one\n\n\ntwo", limit: 4, parts: []string{"one\n", "\ntwo"}},
+		{name: "leading blank line kept", text: "abc\n\nde", limit: 3, parts: []string{"abc", "\nde"}},
+		{name: "blank only part dropped", text: "abcde\n\nfghij", limit: 5, parts: []string{"abcde", "fghij"}},
+		// Characters outside the BMP are two UTF-16 code units for Telegram
+		{name: "counted in UTF-16", text: "😀😀\n😀", limit: 4, parts: []string{"😀😀", "😀"}},
+		{name: "emoji not split", text: "a😀😀", limit: 2, parts: []string{"a", "😀", "😀"}},
+		{name: "accents are one unit", text: "éé\né", limit: 4, parts: []string{"éé\né"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := splitMessage(tt.text, tt.limit)
+			if !reflect.DeepEqual(parts, tt.parts) {
+				t.Errorf("splitMessage(%q, %d) = %q, want %q", tt.text, tt.limit, parts, tt.parts)
+			}
+			for _, part := range parts {
+				if utf16Len(part) > tt.limit {
+					t.Errorf("part %q is %d units long, over %d", part, utf16Len(part), tt.limit)
+				}
+			}
+		})
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	text := `a_b*c [x](y) <tag> & "q" 1.2-3!`
+	tests := []struct {
+		parseMode string
+		escaped   string
+		code      string
+		link      string
+	}{
+		{
+			parseMode: parseModeHTML,
+			escaped:   `a_b*c [x](y) &lt;tag&gt; &amp; &#34;q&#34; 1.2-3!`,
+			code:      "<code>a&lt;b&gt;`c`</code>",
+			link:      `<a href="https://x.io/?a=1&amp;b=&#34;2&#34;">p&lt;1&gt;</a>`,
+		},
+		{
+			parseMode: parseModeMarkdownV2,
+			escaped:   `a\_b\*c \[x\]\(y\) <tag\> & "q" 1\.2\-3\!`,
+			code:      "`a<b>\\`c\\``",
+			link:      `[p<1\>](https://x.io/?a=1&b="2")`,
+		},
+		{parseMode: "", escaped: text, code: "a<b>`c`", link: "p<1>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.parseMode, func(t *testing.T) {
+			if got := escapeText(text, tt.parseMode); got != tt.escaped {
+				t.Errorf("escapeText() = %s, want %s", got, tt.escaped)
+			}
+			if got := code("a<b>`c`", tt.parseMode); got != tt.code {
+				t.Errorf("code() = %s, want %s", got, tt.code)
+			}
+			if got := link("p<1>", `https://x.io/?a=1&b="2"`, tt.parseMode); got != tt.link {
+				t.Errorf("link() = %s, want %s", got, tt.link)
+			}
+		})
+	}
+}
+
+func TestFormatEventSplitsOnLines(t *testing.T) {
+	event := events.Event{Kind: events.KindAssetsAdded, Platform: "hackerone", Program: "acme"}
+	for i := 0; i < 400; i++ {
+		event.Assets = append(event.Assets, strings.Repeat("x", 20)+"_a.com")
+	}
+	for _, parseMode := range []string{parseModeHTML, parseModeMarkdownV2} {
+		parts := splitMessage(formatEvent(event, parseMode), telegramMaxLength)
+		if len(parts) < 2 {
+			t.Fatalf("%s: %d parts, want the assets split", parseMode, len(parts))
+		}
+		// Every part starts and ends on a complete line of markup
+		for _, part := range parts {
+			if strings.Count(part, "<code>") != strings.Count(part, "</code>") || strings.Count(part, "`")%2 != 0 {
+				t.Errorf("%s: part with unbalanced markup: %.80q", parseMode, part)
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// maxRateLimitRetries is how many 429 responses a single send tolerates
+const maxRateLimitRetries = 5
+
+// retryAfterError is returned when Telegram answers 429 with parameters.retry_after
+type retryAfterError struct {
+	After time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return fmt.Sprintf("telegram rate limit, retry after %v", e.After)
+}
+
+// clock is the time source of the rate limits, tests replace it to run without waiting
+type clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// tokenBucket allows rate sends per second with bursts up to capacity
+type tokenBucket struct {
+	mu          sync.Mutex
+	clock       clock
+	capacity    float64
+	tokens      float64
+	rate        float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func newTokenBucket(c clock, rate float64, capacity int) *tokenBucket {
+	return &tokenBucket{
+		clock:    c,
+		capacity: float64(capacity),
+		tokens:   float64(capacity),
+		rate:     rate,
+		last:     c.Now(),
+	}
+}
+
+// Wait blocks until a token is available and takes it
+func (b *tokenBucket) Wait() {
+	for {
+		b.mu.Lock()
+		now := b.clock.Now()
+		if now.Before(b.pausedUntil) {
+			wait := b.pausedUntil.Sub(now)
+			b.mu.Unlock()
+			b.clock.Sleep(wait)
+			continue
+		}
+
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return
+		}
+		// Rounded up, a wait truncated to nothing would spin
+		wait := time.Duration(math.Ceil((1 - b.tokens) / b.rate * float64(time.Second)))
+		b.mu.Unlock()
+		b.clock.Sleep(wait)
+	}
+}
+
+// Pause stops handing out tokens for d, and drops the ones already accumulated
+func (b *tokenBucket) Pause(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	until := b.clock.Now().Add(d)
+	if until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+	b.tokens = 0
+	b.last = until
+}
+
+type sendJob struct {
+	send func() error
+	done chan error
+}
+
+// chatQueue sends the jobs of a single chat in order
+type chatQueue struct {
+	jobs   chan sendJob
+	bucket *tokenBucket
+}
+
+// sendQueue serializes sends per chat and applies a global and a per-chat token bucket
+type sendQueue struct {
+	mu          sync.Mutex
+	clock       clock
+	global      *tokenBucket
+	chatPerMin  int
+	chats       map[string]*chatQueue
+	queueLength int
+}
+
+func newSendQueue(globalPerSecond, chatPerMinute int) *sendQueue {
+	return newSendQueueClock(realClock{}, globalPerSecond, chatPerMinute)
+}
+
+func newSendQueueClock(c clock, globalPerSecond, chatPerMinute int) *sendQueue {
+	return &sendQueue{
+		clock:       c,
+		global:      newTokenBucket(c, float64(globalPerSecond), globalPerSecond),
+		chatPerMin:  chatPerMinute,
+		chats:       make(map[string]*chatQueue),
+		queueLength: 100,
+	}
+}
+
+// Send queues send for chatID and waits for its result
+func (q *sendQueue) Send(chatID string, send func() error) error {
+	job := sendJob{send: send, done: make(chan error, 1)}
+	q.chat(chatID).jobs <- job
+	return <-job.done
+}
+
+func (q *sendQueue) chat(chatID string) *chatQueue {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cq, ok := q.chats[chatID]
+	if !ok {
+		cq = &chatQueue{
+			jobs:   make(chan sendJob, q.queueLength),
+			bucket: newTokenBucket(q.clock, float64(q.chatPerMin)/60, 1),
+		}
+		q.chats[chatID] = cq
+		go q.run(chatID, cq)
+	}
+	return cq
+}
+
+func (q *sendQueue) run(chatID string, cq *chatQueue) {
+	for job := range cq.jobs {
+		var err error
+		for attempt := 0; attempt <= maxRateLimitRetries; attempt++ {
+			cq.bucket.Wait()
+			q.global.Wait()
+
+			err = job.send()
+			rateErr, limited := err.(*retryAfterError)
+			if !limited {
+				break
+			}
+
+			// Telegram told us how long to back off, nothing is sent to this chat meanwhile
+			log.Printf("Rate limited on chat %s, waiting %v", chatID, rateErr.After)
+			cq.bucket.Pause(rateErr.After)
+		}
+		job.done <- err
+	}
+}
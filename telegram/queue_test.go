@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when someone sleeps on it
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestSendQueueKeepsChatOrder(t *testing.T) {
+	q := newSendQueue(1000, 60000)
+
+	var mu sync.Mutex
+	var order []int
+	release := make(chan struct{})
+	blocked := make(chan struct{})
+
+	// The first send holds the chat while the others queue up behind it
+	go q.Send("a", func() error {
+		close(blocked)
+		<-release
+		return nil
+	})
+	<-blocked
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			q.Send("a", func() error {
+				mu.Lock()
+				order = append(order, i)
+				mu.Unlock()
+				return nil
+			})
+		}(i)
+		// Wait until it is queued so that the queue order is known
+		for len(q.chat("a").jobs) < i {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Another chat is not held up by the first one
+	err := q.Send("b", func() error { return nil })
+	if err != nil {
+		t.Fatalf("Send(b): %v", err)
+	}
+
+	close(release)
+	wg.Wait()
+	if !reflect.DeepEqual(order, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}) {
+		t.Errorf("sends of the chat ran in order %v", order)
+	}
+}
+
+func TestSendQueueGlobalBudget(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+	q := newSendQueueClock(clock, 3, 60)
+
+	// A new chat each time, only the global budget of 3 per second applies
+	var sent []time.Duration
+	for i := 0; i < 7; i++ {
+		err := q.Send(fmt.Sprint(i), func() error {
+			sent = append(sent, clock.Now().Sub(start))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	// The burst goes out at once, then one send every third of a second
+	for i, at := range sent {
+		want := time.Duration(0)
+		if i >= 3 {
+			want = time.Duration(i-2) * time.Second / 3
+		}
+		if at < want || at > want+time.Microsecond {
+			t.Errorf("send %d at %v, want %v", i, at, want)
+		}
+	}
+}
+
+func TestSendQueueChatBudget(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+	q := newSendQueueClock(clock, 30, 20)
+
+	var sent []time.Duration
+	for i := 0; i < 3; i++ {
+		q.Send("a", func() error {
+			sent = append(sent, clock.Now().Sub(start))
+			return nil
+		})
+	}
+	// 20 per minute is one every 3 seconds
+	want := []time.Duration{0, 3 * time.Second, 6 * time.Second}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("sends at %v, want %v", sent, want)
+	}
+}
+
+func TestSendQueueRetryAfter(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+	q := newSendQueueClock(clock, 30, 60000)
+
+	var attempts []time.Duration
+	err := q.Send("a", func() error {
+		attempts = append(attempts, clock.Now().Sub(start))
+		if len(attempts) == 1 {
+			return &retryAfterError{After: 5 * time.Second}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Send() = %v, want the retry to succeed", err)
+	}
+	if len(attempts) != 2 || attempts[1] < 5*time.Second {
+		t.Errorf("attempts at %v, want the retry after the 5s pause", attempts)
+	}
+
+	// The chat stays limited for the whole pause, even for the next message
+	before := clock.Now()
+	q.chat("a").bucket.Pause(10 * time.Second)
+	q.Send("a", func() error { return nil })
+	if waited := clock.Now().Sub(before); waited < 10*time.Second {
+		t.Errorf("next send after %v, want the 10s pause", waited)
+	}
+}
+
+func TestSendQueueRetryLimit(t *testing.T) {
+	q := newSendQueueClock(newFakeClock(), 30, 60000)
+
+	attempts := 0
+	err := q.Send("a", func() error {
+		attempts++
+		return &retryAfterError{After: time.Second}
+	})
+	if _, limited := err.(*retryAfterError); !limited {
+		t.Errorf("Send() = %v, want the rate limit error", err)
+	}
+	if attempts != maxRateLimitRetries+1 {
+		t.Errorf("%d attempts, want %d", attempts, maxRateLimitRetries+1)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// chatTarget is a chat, optionally a forum topic of it
+type chatTarget struct {
+	ChatID   string `json:"chat_id"`
+	ThreadID int    `json:"thread_id,omitempty"`
+}
+
+// key identifies the target, it is the batch key of the events sent to it
+func (t chatTarget) key() string {
+	return fmt.Sprintf("%s:%d", t.ChatID, t.ThreadID)
+}
+
+// parseTargetKey is the inverse of chatTarget.key
+func parseTargetKey(key string) chatTarget {
+	i := strings.LastIndex(key, ":")
+	if i < 0 {
+		return chatTarget{ChatID: key}
+	}
+	threadID, _ := strconv.Atoi(key[i+1:])
+	return chatTarget{ChatID: key[:i], ThreadID: threadID}
+}
+
+// routeRule sends the matching events to its targets. Empty fields match everything.
+// When AssetPattern is set only the matching assets are routed.
+type routeRule struct {
+	Kinds        []events.Kind `json:"kinds"`
+	Platforms    []string      `json:"platforms"`
+	Programs     []string      `json:"programs"`
+	AssetPattern string        `json:"asset_pattern"`
+	Targets      []chatTarget  `json:"targets"`
+	Continue     bool          `json:"continue"` // keep evaluating the next rules after a match
+
+	assetRegexp *regexp.Regexp
+}
+
+// delivery is an event, possibly with a subset of its assets, to send to a target
+type delivery struct {
+	Target chatTarget
+	Event  events.Event
+}
+
+// loadRoutes reads the routing rules from a JSON file, no file means no rules
+func loadRoutes(path string) ([]routeRule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading routes file: %w", err)
+	}
+
+	var rules []routeRule
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing routes file: %w", err)
+	}
+	for i := range rules {
+		if rules[i].AssetPattern != "" {
+			rules[i].assetRegexp, err = regexp.Compile(rules[i].AssetPattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid asset pattern in rule %d: %w", i+1, err)
+			}
+		}
+		if len(rules[i].Targets) == 0 {
+			return nil, fmt.Errorf("rule %d has no targets", i+1)
+		}
+	}
+	return rules, nil
+}
+
+func matchesAny[T comparable](values []T, value T) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// routeEvent returns the deliveries of an event. Assets claimed by a stopping rule are not
+// routed further, and whatever no rule claimed goes to the fallback target.
+func routeEvent(rules []routeRule, fallback chatTarget, event events.Event) []delivery {
+	var deliveries []delivery
+	remaining := event.Assets
+	hasAssets := len(event.Assets) > 0
+
+	for _, rule := range rules {
+		if !matchesAny(rule.Kinds, event.Kind) || !matchesAny(rule.Platforms, event.Platform) || !matchesAny(rule.Programs, event.Program) {
+			continue
+		}
+
+		routed := event
+		var unmatched []string
+		if rule.assetRegexp != nil {
+			if !hasAssets {
+				continue
+			}
+			var matched []string
+			for _, asset := range remaining {
+				if rule.assetRegexp.MatchString(asset) {
+					matched = append(matched, asset)
+				} else {
+					unmatched = append(unmatched, asset)
+				}
+			}
+			if len(matched) == 0 {
+				continue
+			}
+			routed.Assets = matched
+		} else {
+			routed.Assets = remaining
+		}
+
+		for _, target := range rule.Targets {
+			deliveries = append(deliveries, delivery{Target: target, Event: routed})
+		}
+
+		if !rule.Continue {
+			remaining = unmatched
+			if rule.assetRegexp == nil || len(remaining) == 0 {
+				return deliveries
+			}
+		}
+	}
+
+	// Events no stopping rule claimed entirely also go to the fallback
+	if !hasAssets || len(remaining) > 0 {
+		routed := event
+		routed.Assets = remaining
+		deliveries = append(deliveries, delivery{Target: fallback, Event: routed})
+	}
+	return deliveries
+}
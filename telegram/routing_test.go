@@ -0,0 +1,140 @@
+package main
+
+import (
+	"BugBountyGoApiWrapper/events"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeRoutes(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "routes.json")
+	err := os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+const testRoutes = `[
+	{"kinds": ["program_added"], "targets": [{"chat_id": "programs"}]},
+	{"platforms": ["intigriti"], "targets": [{"chat_id": "intigriti"}]},
+	{"programs": ["acme"], "asset_pattern": "\\.acme\\.com$", "targets": [{"chat_id": "team", "thread_id": 7}]},
+	{"programs": ["acme"], "continue": true, "targets": [{"chat_id": "audit"}]},
+	{"kinds": ["takeover"], "targets": [{"chat_id": "alerts"}, {"chat_id": "alerts", "thread_id": 2}]}
+]`
+
+func TestRouteEvent(t *testing.T) {
+	rules, err := loadRoutes(writeRoutes(t, testRoutes))
+	if err != nil {
+		t.Fatalf("loadRoutes: %v", err)
+	}
+	fallback := chatTarget{ChatID: "default"}
+
+	// routed lists target keys with the assets delivered there
+	tests := []struct {
+		name   string
+		event  events.Event
+		routed map[string][]string
+	}{
+		{
+			name:   "kind",
+			event:  events.Event{Kind: events.KindProgramAdded, Platform: "hackerone", Program: "new", Assets: []string{"a.new.com"}},
+			routed: map[string][]string{"programs:0": {"a.new.com"}},
+		},
+		{
+			name:   "platform",
+			event:  events.Event{Kind: events.KindAssetsAdded, Platform: "intigriti", Program: "x"},
+			routed: map[string][]string{"intigriti:0": nil},
+		},
+		{
+			name:  "program assets split by pattern, to a topic",
+			event: events.Event{Kind: events.KindAssetsAdded, Platform: "hackerone", Program: "acme", Assets: []string{"api.acme.com", "acme.io"}},
+			routed: map[string][]string{
+				"team:7":    {"api.acme.com"},
+				"audit:0":   {"acme.io"},
+				"default:0": {"acme.io"},
+			},
+		},
+		{
+			name:   "pattern rule skipped without assets",
+			event:  events.Event{Kind: events.KindPolicyChanged, Platform: "hackerone", Program: "acme"},
+			routed: map[string][]string{"audit:0": nil, "default:0": nil},
+		},
+		{
+			name:   "every target of the rule",
+			event:  events.Event{Kind: events.KindTakeover, Platform: "hackerone", Program: "other", Assets: []string{"x.other.com"}},
+			routed: map[string][]string{"alerts:0": {"x.other.com"}, "alerts:2": {"x.other.com"}},
+		},
+		{
+			name:   "no match goes to the default chat",
+			event:  events.Event{Kind: events.KindAssetsRemoved, Platform: "hackerone", Program: "other", Assets: []string{"b.other.com"}},
+			routed: map[string][]string{"default:0": {"b.other.com"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routed := make(map[string][]string)
+			for _, d := range routeEvent(rules, fallback, tt.event) {
+				if _, ok := routed[d.Target.key()]; ok {
+					t.Errorf("target %s delivered twice", d.Target.key())
+				}
+				routed[d.Target.key()] = d.Event.Assets
+				if d.Event.Program != tt.event.Program || d.Event.Kind != tt.event.Kind {
+					t.Errorf("delivery to %s changed the event: %+v", d.Target.key(), d.Event)
+				}
+			}
+			if !reflect.DeepEqual(routed, tt.routed) {
+				t.Errorf("routeEvent() = %v, want %v", routed, tt.routed)
+			}
+		})
+	}
+}
+
+func TestRouteEventWithoutRules(t *testing.T) {
+	event := events.Event{Kind: events.KindAssetsAdded, Assets: []string{"a.com"}}
+	deliveries := routeEvent(nil, chatTarget{ChatID: "default", ThreadID: 3}, event)
+	if len(deliveries) != 1 || deliveries[0].Target.key() != "default:3" || !reflect.DeepEqual(deliveries[0].Event.Assets, event.Assets) {
+		t.Errorf("routeEvent() = %+v, want the whole event to the default chat", deliveries)
+	}
+}
+
+func TestLoadRoutesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "invalid regex", content: `[{"asset_pattern": "([a-z", "targets": [{"chat_id": "1"}]}]`, err: "invalid asset pattern in rule 1"},
+		{name: "no targets", content: `[{"kinds": ["takeover"]}, {"programs": ["acme"]}]`, err: "rule 1 has no targets"},
+		{name: "invalid JSON", content: `{"kinds": []}`, err: "error parsing routes file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadRoutes(writeRoutes(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("loadRoutes() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	rules, err := loadRoutes("")
+	if err != nil || rules != nil {
+		t.Errorf("loadRoutes(\"\") = %v, %v, want no rules", rules, err)
+	}
+	_, err = loadRoutes(filepath.Join(t.TempDir(), "missing.json"))
+	if err == nil {
+		t.Errorf("loadRoutes() of a missing file succeeded")
+	}
+}
+
+func TestParseTargetKey(t *testing.T) {
+	for _, target := range []chatTarget{{ChatID: "-100123"}, {ChatID: "-100123", ThreadID: 42}, {ChatID: "@channel"}} {
+		if got := parseTargetKey(target.key()); got != target {
+			t.Errorf("parseTargetKey(%q) = %+v, want %+v", target.key(), got, target)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"BugBountyGoApiWrapper/env"
+	"BugBountyGoApiWrapper/events"
+	"BugBountyGoApiWrapper/notifier"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -9,15 +11,50 @@ import (
 	"github.com/redis/go-redis/v9"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 )
 
 func main() {
 	botToken := env.Env["TELEGRAM_BOT_TOKEN"]
 	chatID := env.Env["TELEGRAM_CHAT_ID"]
-	redisChannel := "telegram_notifications"
+
+	// HTML by default, MarkdownV2 or plain for raw text
+	parseMode := parseModeHTML
+	if mode, ok := env.Env["TELEGRAM_PARSE_MODE"]; ok {
+		parseMode = mode
+		if mode == "plain" {
+			parseMode = ""
+		}
+	}
+
+	// Events are sent to TELEGRAM_CHAT_ID unless a routing rule sends them elsewhere
+	routes, err := loadRoutes(env.Env["TELEGRAM_ROUTES_FILE"])
+	if err != nil {
+		log.Fatal("Error loading routes:", err)
+	}
+
+	// A rate of 0 would make the token buckets wait forever
+	globalPerSecond := env.GetInt("TELEGRAM_GLOBAL_PER_SECOND", 30)
+	chatPerMinute := env.GetInt("TELEGRAM_CHAT_PER_MINUTE", 20)
+	if globalPerSecond <= 0 || chatPerMinute <= 0 {
+		log.Fatalf("TELEGRAM_GLOBAL_PER_SECOND and TELEGRAM_CHAT_PER_MINUTE must be positive, got %d and %d", globalPerSecond, chatPerMinute)
+	}
+
+	bot := &telegramBot{
+		Token:     botToken,
+		ChatID:    chatID,
+		Routes:    routes,
+		ParseMode: parseMode,
+		// Lists longer than the threshold are sent as a txt or csv document
+		DocumentThreshold: env.GetInt("TELEGRAM_DOCUMENT_THRESHOLD", 50),
+		DocumentFormat:    env.Env["TELEGRAM_DOCUMENT_FORMAT"],
+		// Telegram allows about 30 messages per second overall and 20 per minute in a group
+		Queue: newSendQueue(globalPerSecond, chatPerMinute),
+	}
 
 	rdb := redis.NewClient(&redis.Options{
 		Addr: "localhost:6379",
@@ -25,56 +62,248 @@ func main() {
 
 	ctx := context.Background()
 
-	pubsub := rdb.Subscribe(ctx, redisChannel)
-	defer pubsub.Close()
+	// Bursts are coalesced per route for NOTIFY_BATCH_SECONDS, 0 sends every event right away
+	batchWindow := time.Duration(env.GetInt("NOTIFY_BATCH_SECONDS", 0)) * time.Second
+	bypass := []events.Kind{events.KindProgramAdded}
+	if kinds, ok := env.Env["NOTIFY_BATCH_BYPASS_KINDS"]; ok {
+		bypass = nil
+		for _, kind := range splitList(kinds) {
+			bypass = append(bypass, events.Kind(kind))
+		}
+	}
+	// Batches that keep failing are capped to their NOTIFY_BATCH_MAX_EVENTS newest events
+	maxBatched := env.GetInt("NOTIFY_BATCH_MAX_EVENTS", 1000)
+	batch := func(n notifier.Notifier) notifier.Notifier {
+		if batchWindow <= 0 {
+			return n
+		}
+		b := notifier.NewBatcher(rdb, n.Name(), batchWindow, bypass)
+		b.MaxQueued = maxBatched
+		go b.Run(ctx)
+		return notifier.WithBatching(n, b)
+	}
 
-	_, err := pubsub.Receive(ctx)
-	if err != nil {
-		log.Fatal("Error subscribing to channel:", err)
+	// Every backend consumes the stream in its own group, so each one gets every event
+	backends := env.Env["NOTIFIERS"]
+	if backends == "" {
+		backends = "telegram"
+	}
+	var notifiers []notifier.Notifier
+	for _, name := range strings.Split(backends, ",") {
+		switch strings.TrimSpace(name) {
+		case "telegram":
+			// Telegram batches after routing, one batch per chat
+			if batchWindow > 0 {
+				bot.Batcher = notifier.NewBatcher(rdb, bot.Name(), batchWindow, bypass)
+				bot.Batcher.Send = bot.sendBatch
+				bot.Batcher.MaxQueued = maxBatched
+				go bot.Batcher.Run(ctx)
+			}
+			notifiers = append(notifiers, bot)
+		case "slack":
+			notifiers = append(notifiers, batch(notifier.NewSlack(env.Env["SLACK_WEBHOOK_URL"])))
+		case "discord":
+			notifiers = append(notifiers, batch(notifier.NewDiscord(env.Env["DISCORD_WEBHOOK_URL"])))
+		case "webhook":
+			notifiers = append(notifiers, batch(notifier.NewWebhook(env.Env["WEBHOOK_URL"], env.Env["WEBHOOK_SECRET"])))
+		case "email":
+			// Events are queued in Redis and mailed as one digest per hour or day
+			email := &notifier.EmailNotifier{
+				Client:   rdb,
+				Host:     env.Env["SMTP_HOST"],
+				Port:     env.GetInt("SMTP_PORT", 587),
+				Username: env.Env["SMTP_USERNAME"],
+				Password: env.Env["SMTP_PASSWORD"],
+				From:     env.Env["SMTP_FROM"],
+				To:       splitList(env.Env["SMTP_TO"]),
+				StartTLS: env.Env["SMTP_STARTTLS"] != "false",
+				Schedule: env.Env["EMAIL_DIGEST_SCHEDULE"],
+				Hour:     env.GetInt("EMAIL_DIGEST_HOUR", 8),
+				// Events beyond the cap are dropped, oldest first, while SMTP keeps failing
+				MaxQueued: env.GetInt("EMAIL_DIGEST_MAX_EVENTS", 5000),
+			}
+			go email.RunDigest(ctx)
+			notifiers = append(notifiers, email)
+		case "":
+		default:
+			log.Fatalf("Unknown notifier %q", name)
+		}
+	}
+	if len(notifiers) == 0 {
+		log.Fatal("No notifiers configured")
+	}
+
+	// Commands are accepted from the notification chat and the admin chats
+	if botToken != "" {
+		authorized := map[string]bool{chatID: true}
+		for _, id := range splitList(env.Env["TELEGRAM_ADMIN_CHAT_IDS"]) {
+			authorized[id] = true
+		}
+		// Anyone in an authorized chat can query, only these users can run admin commands
+		admins := make(map[string]bool)
+		for _, id := range splitList(env.Env["TELEGRAM_ADMIN_USER_IDS"]) {
+			admins[id] = true
+		}
+		commands := &commandHandler{Bot: bot, Redis: rdb, Authorized: authorized, Admins: admins}
+		go commands.poll(ctx)
 	}
 
-	log.Printf("Listening for messages on channel: %s", redisChannel)
+	// A diff republished after a producer crash is dropped within the window
+	dedupWindow := time.Duration(env.GetInt("NOTIFY_DEDUP_MINUTES", 60)) * time.Minute
 
-	ch := pubsub.Channel()
-	var wg sync.WaitGroup
+	for _, n := range notifiers[1:] {
+		go notifier.Run(ctx, rdb, n, dedupWindow)
+	}
+	notifier.Run(ctx, rdb, notifiers[0], dedupWindow)
+}
 
-	for msg := range ch {
-		wg.Add(1)
-		go func(message string) {
-			defer wg.Done()
+// splitList returns the non-empty comma separated values of s
+func splitList(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
 
-			// Send to Telegram with retry
-			maxRetries := 3
-			retryDelay := time.Second
+type telegramBot struct {
+	Token             string
+	ChatID            string
+	Routes            []routeRule
+	ParseMode         string
+	DocumentThreshold int
+	DocumentFormat    string
+	Queue             *sendQueue
+	Batcher           *notifier.Batcher
+}
 
-			for attempt := 1; attempt <= maxRetries; attempt++ {
-				err := sendToTelegram(botToken, chatID, message)
-				if err == nil {
-					log.Printf("Message sent successfully (attempt %d)", attempt)
-					return
-				}
+func (bot *telegramBot) Name() string {
+	return "telegram"
+}
 
-				log.Printf("Attempt %d failed: %v", attempt, err)
+// Notify sends the event to the chats it is routed to, batching it per chat when enabled
+func (bot *telegramBot) Notify(ctx context.Context, event events.Event) error {
+	var deliveries []delivery
+	for _, d := range routeEvent(bot.Routes, chatTarget{ChatID: bot.ChatID}, event) {
+		if bot.Batcher != nil {
+			queued, err := bot.Batcher.Add(ctx, d.Target.key(), d.Event)
+			if err != nil {
+				log.Printf("Error batching event, sending it now: %v", err)
+			}
+			if queued {
+				continue
+			}
+		}
+		deliveries = append(deliveries, d)
+	}
+	return bot.deliver(deliveries)
+}
+
+// sendBatch sends the digest of a batch to the chat it was queued for
+func (bot *telegramBot) sendBatch(ctx context.Context, key string, event events.Event) error {
+	return bot.deliver([]delivery{{Target: parseTargetKey(key), Event: event}})
+}
+
+// deliver sends the deliveries, retrying the ones that failed
+func (bot *telegramBot) deliver(routed []delivery) error {
+	type routedDelivery struct {
+		delivery
+		parseMode string
+		parts     []string
+		sentParts int
+		done      bool
+	}
+	var deliveries []*routedDelivery
+	for _, d := range routed {
+		parseMode := bot.ParseMode
+		// Plain-text messages from older producers are not escaped
+		if d.Event.Kind == events.KindText {
+			parseMode = ""
+		}
+		// The asset list is attached per delivery, routing may have shrunk it
+		d.Event = attachAssets(d.Event, bot.DocumentThreshold, bot.DocumentFormat)
+		parts := splitMessage(formatEvent(d.Event, parseMode), telegramMaxLength)
+		if d.Event.Kind == events.KindText && d.Event.Attachment != nil {
+			// Document from an older producer, the caption goes with the file
+			parts = nil
+		}
+		deliveries = append(deliveries, &routedDelivery{delivery: d, parseMode: parseMode, parts: parts})
+	}
 
-				if attempt < maxRetries {
-					log.Printf("Retrying in %v...", retryDelay)
-					time.Sleep(retryDelay)
-					retryDelay *= 2 // Exponential backoff
+	send := func() error {
+		// Deliveries and parts already sent are not sent again when a later one fails
+		for _, d := range deliveries {
+			if d.done {
+				continue
+			}
+			target := d.Target
+			for d.sentParts < len(d.parts) {
+				part := d.parts[d.sentParts]
+				mode := d.parseMode
+				err := bot.Queue.Send(target.ChatID, func() error {
+					return sendToTelegram(bot.Token, target, part, mode)
+				})
+				if err != nil && d.sentParts == 0 && mode != "" && strings.Contains(err.Error(), "can't parse entities") {
+					log.Printf("Markup rejected, falling back to plain text")
+					d.parts = splitMessage(d.Event.Render(), telegramMaxLength)
+					d.parseMode = ""
+					continue
+				}
+				if err != nil {
+					return err
 				}
+				d.sentParts++
 			}
+			if d.Event.Attachment != nil {
+				attachment := *d.Event.Attachment
+				err := bot.Queue.Send(target.ChatID, func() error {
+					return sendDocumentToTelegram(bot.Token, target, attachment)
+				})
+				if err != nil {
+					return err
+				}
+			}
+			d.done = true
+		}
+		return nil
+	}
 
-			log.Printf("Failed to send message after %d attempts: %s", maxRetries, message)
-		}(msg.Payload)
+	// Send to Telegram with retry
+	maxRetries := 3
+	retryDelay := time.Second
+
+	var err error
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		err = send()
+		if err == nil {
+			return nil
+		}
+
+		log.Printf("Attempt %d failed: %v", attempt, err)
+
+		if attempt < maxRetries {
+			log.Printf("Retrying in %v...", retryDelay)
+			time.Sleep(retryDelay)
+			retryDelay *= 2 // Exponential backoff
+		}
 	}
 
-	wg.Wait() // This will never be reached in this case, but good practice
+	return fmt.Errorf("failed after %d attempts: %w", maxRetries, err)
 }
 
-func sendToTelegram(botToken, chatID, text string) error {
-	payload := map[string]string{
-		"chat_id": chatID,
+func sendToTelegram(botToken string, target chatTarget, text, parseMode string) error {
+	payload := map[string]interface{}{
+		"chat_id": target.ChatID,
 		"text":    text,
 	}
+	if parseMode != "" {
+		payload["parse_mode"] = parseMode
+	}
+	if target.ThreadID != 0 {
+		payload["message_thread_id"] = target.ThreadID
+	}
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
@@ -88,8 +317,71 @@ func sendToTelegram(botToken, chatID, text string) error {
 	}
 	defer resp.Body.Close()
 
+	return checkTelegramResponse(resp)
+}
+
+// sendDocumentToTelegram uploads the document content as a file with multipart/form-data
+func sendDocumentToTelegram(botToken string, target chatTarget, doc events.Attachment) error {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	err := writer.WriteField("chat_id", target.ChatID)
+	if err != nil {
+		return fmt.Errorf("error writing form field: %w", err)
+	}
+	if target.ThreadID != 0 {
+		err = writer.WriteField("message_thread_id", strconv.Itoa(target.ThreadID))
+		if err != nil {
+			return fmt.Errorf("error writing form field: %w", err)
+		}
+	}
+	if doc.Caption != "" {
+		err = writer.WriteField("caption", doc.Caption)
+		if err != nil {
+			return fmt.Errorf("error writing form field: %w", err)
+		}
+	}
+	part, err := writer.CreateFormFile("document", doc.Filename)
+	if err != nil {
+		return fmt.Errorf("error creating form file: %w", err)
+	}
+	_, err = io.WriteString(part, doc.Content)
+	if err != nil {
+		return fmt.Errorf("error writing document content: %w", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		return fmt.Errorf("error closing multipart writer: %w", err)
+	}
+
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendDocument", botToken)
+	resp, err := http.Post(url, writer.FormDataContentType(), &buf)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return checkTelegramResponse(resp)
+}
+
+// checkTelegramResponse turns an error response into an error, a 429 into a retryAfterError
+func checkTelegramResponse(resp *http.Response) error {
 	body, _ := io.ReadAll(resp.Body)
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		var apiError struct {
+			Parameters struct {
+				RetryAfter int `json:"retry_after"`
+			} `json:"parameters"`
+		}
+		json.Unmarshal(body, &apiError)
+		retryAfter := apiError.Parameters.RetryAfter
+		if retryAfter <= 0 {
+			retryAfter = 5
+		}
+		return &retryAfterError{After: time.Duration(retryAfter) * time.Second}
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("telegram API error: %s - %s", resp.Status, string(body))
 	}
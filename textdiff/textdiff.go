@@ -0,0 +1,182 @@
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type lineOp struct {
+	Kind opKind
+	Line string
+	A    int // index in a (for equal/delete)
+	B    int // index in b (for equal/insert)
+}
+
+// Unified returns a unified diff between a and b, with context lines around each change.
+// It returns an empty string when both texts are identical.
+func Unified(fromName, toName, a, b string, context int) string {
+	unified, _, _ := Diff(fromName, toName, a, b, context)
+	return unified
+}
+
+// Diff returns the unified diff between a and b along with the number of added and removed
+// lines, all from a single pass
+func Diff(fromName, toName, a, b string, context int) (unified string, added int, removed int) {
+	if a == b {
+		return "", 0, 0
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+	for _, op := range ops {
+		switch op.Kind {
+		case opInsert:
+			added++
+		case opDelete:
+			removed++
+		}
+	}
+	// Texts that only differ by line endings have no changes
+	if added == 0 && removed == 0 {
+		return "", 0, 0
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n", fromName)
+	fmt.Fprintf(&sb, "+++ %s\n", toName)
+
+	for _, hunk := range groupHunks(ops, context) {
+		writeHunk(&sb, hunk)
+	}
+	return sb.String(), added, removed
+}
+
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes a line diff using the longest common subsequence
+func diffLines(a, b []string) []lineOp {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []lineOp
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, lineOp{opEqual, a[i], i, j})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, lineOp{opDelete, a[i], i, j})
+			i++
+		default:
+			ops = append(ops, lineOp{opInsert, b[j], i, j})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, lineOp{opDelete, a[i], i, j})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, lineOp{opInsert, b[j], i, j})
+	}
+	return ops
+}
+
+// groupHunks splits the ops into hunks, keeping context equal lines around changes
+func groupHunks(ops []lineOp, context int) [][]lineOp {
+	var hunks [][]lineOp
+	start, end := -1, -1
+
+	for idx, op := range ops {
+		if op.Kind == opEqual {
+			continue
+		}
+		lo := idx - context
+		if lo < 0 {
+			lo = 0
+		}
+		hi := idx + context + 1
+		if hi > len(ops) {
+			hi = len(ops)
+		}
+		if start == -1 {
+			start, end = lo, hi
+			continue
+		}
+		if lo <= end {
+			end = hi
+			continue
+		}
+		hunks = append(hunks, ops[start:end])
+		start, end = lo, hi
+	}
+	if start != -1 {
+		hunks = append(hunks, ops[start:end])
+	}
+	return hunks
+}
+
+func writeHunk(sb *strings.Builder, hunk []lineOp) {
+	aStart, bStart := hunk[0].A, hunk[0].B
+	aCount, bCount := 0, 0
+	for _, op := range hunk {
+		switch op.Kind {
+		case opEqual:
+			aCount++
+			bCount++
+		case opDelete:
+			aCount++
+		case opInsert:
+			bCount++
+		}
+	}
+
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+	for _, op := range hunk {
+		switch op.Kind {
+		case opEqual:
+			sb.WriteString(" " + op.Line + "\n")
+		case opDelete:
+			sb.WriteString("-" + op.Line + "\n")
+		case opInsert:
+			sb.WriteString("+" + op.Line + "\n")
+		}
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
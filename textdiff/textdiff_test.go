@@ -0,0 +1,73 @@
+package textdiff
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		unified string
+		added   int
+		removed int
+	}{
+		{name: "both empty"},
+		{name: "identical", a: "one\ntwo\n", b: "one\ntwo\n"},
+		{name: "line endings only", a: "one\r\ntwo\r\n", b: "one\ntwo\n"},
+		{
+			name:    "from empty",
+			b:       "one\ntwo\n",
+			unified: "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+one\n+two\n",
+			added:   2,
+		},
+		{
+			name:    "to empty",
+			a:       "one\n",
+			unified: "--- a\n+++ b\n@@ -1 +0,0 @@\n-one\n",
+			removed: 1,
+		},
+		{
+			name:    "insert at the start",
+			a:       "two\nthree\n",
+			b:       "one\ntwo\nthree\n",
+			unified: "--- a\n+++ b\n@@ -1 +1,2 @@\n+one\n two\n",
+			added:   1,
+		},
+		{
+			name:    "delete at the end",
+			a:       "one\ntwo\nthree\n",
+			b:       "one\ntwo\n",
+			unified: "--- a\n+++ b\n@@ -2,2 +2 @@\n two\n-three\n",
+			removed: 1,
+		},
+		{
+			name:    "change with CRLF",
+			a:       "one\r\ntwo\r\nthree\r\n",
+			b:       "one\ntwo!\nthree\n",
+			unified: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n one\n-two\n+two!\n three\n",
+			added:   1,
+			removed: 1,
+		},
+		{
+			name:    "distant changes in separate hunks",
+			a:       "a\nb\nc\nd\ne\nf\ng\n",
+			b:       "A\nb\nc\nd\ne\nf\nG\n",
+			unified: "--- a\n+++ b\n@@ -1,2 +1,2 @@\n-a\n+A\n b\n@@ -6,2 +6,2 @@\n f\n-g\n+G\n",
+			added:   2,
+			removed: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unified, added, removed := Diff("a", "b", tt.a, tt.b, 1)
+			if unified != tt.unified {
+				t.Errorf("Diff() =\n%s\nwant\n%s", unified, tt.unified)
+			}
+			if added != tt.added || removed != tt.removed {
+				t.Errorf("Diff() counted +%d -%d, want +%d -%d", added, removed, tt.added, tt.removed)
+			}
+			if got := Unified("a", "b", tt.a, tt.b, 1); got != unified {
+				t.Errorf("Unified() differs from Diff()")
+			}
+		})
+	}
+}